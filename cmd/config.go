@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/uitml/quimby/internal/cli"
+	"github.com/uitml/quimby/internal/k8s"
+	"github.com/uitml/quimby/internal/user/reader"
+	"gopkg.in/yaml.v2"
+)
+
+func newConfigCmd() *cobra.Command {
+	var configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Manage the quimby configuration.",
+
+		RunE: func(*cobra.Command, []string) error { return fmt.Errorf("missing subcommand") },
+	}
+
+	var initCmd = &cobra.Command{
+		Use:   "init",
+		Short: "Create a config file interactively.",
+		Long: "Create a config file interactively.\n\n" +
+			"If the config file exists, the prompted settings are overwritten and the others, such as\n" +
+			"profiles and accelerators, are kept.",
+		Args: cobra.NoArgs,
+
+		RunE: RunConfigInit,
+	}
+
+	var viewCmd = &cobra.Command{
+		Use:   "view",
+		Short: "Show the effective configuration, with secrets redacted.",
+		Args:  cobra.NoArgs,
+
+		RunE: RunConfigView,
+	}
+
+	var setCmd = &cobra.Command{
+		Use:     "set <key> <value>",
+		Short:   "Set a value in the config file.",
+		Example: "  quimby config set githubrepo uitml/springfield\n  quimby config set profiles.staging.context springfield-staging",
+		Args:    cobra.ExactArgs(2),
+
+		RunE: RunConfigSet,
+	}
+
+	var validateCmd = &cobra.Command{
+		Use:   "validate",
+		Short: "Check that the templates and the cluster can be reached.",
+		Args:  cobra.NoArgs,
+
+		RunE: RunConfigValidate,
+	}
+
+	var useProfileCmd = &cobra.Command{
+		Use:   "use-profile <name>",
+		Short: "Set the current profile.",
+		Args:  cobra.ExactArgs(1),
+
+		RunE: RunUseProfile,
+	}
+
+	configCmd.AddCommand(initCmd)
+	configCmd.AddCommand(viewCmd)
+	configCmd.AddCommand(setCmd)
+	configCmd.AddCommand(validateCmd)
+	configCmd.AddCommand(useProfileCmd)
+
+	return configCmd
+}
+
+func RunConfigInit(cmd *cobra.Command, args []string) error {
+	path, err := cli.ConfigFile()
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		c, err := cli.Confirmation("Config file "+path+" already exists. Overwrite the prompted settings?", false)
+		if err != nil {
+			return err
+		}
+		if !c {
+			fmt.Println("Config file not changed.")
+			return nil
+		}
+	}
+
+	prompts := []struct {
+		key    string
+		text   string
+		def    string
+		secret bool
+	}{
+		{"githubrepo", "GitHub repo with the user templates (owner/name)", "", false},
+		{"githubuser", "GitHub username", "", false},
+		{"githubtoken", "GitHub personal access token", "", true},
+		{"githubconfigdir", "Directory of the quimby template in the repo", "config", false},
+		{"githubvaluedir", "Directory of the default values in the repo", "values", false},
+		{"context", "Kubeconfig context of the cluster (empty for the current context)", "", false},
+		{"emaildomain", "Domain of generated e-mail addresses", "post.uit.no", false},
+	}
+
+	values := make(map[string]interface{})
+	for _, p := range prompts {
+		var answer string
+		if p.secret {
+			answer, err = cli.PromptSecret(p.text, p.def)
+		} else {
+			answer, err = cli.Prompt(p.text, p.def)
+		}
+		if err != nil {
+			return err
+		}
+		values[p.key] = answer
+	}
+	if values["githubrepo"] == "" {
+		return errors.New("a GitHub repo is required")
+	}
+
+	if err := cli.SetConfigValues(path, values); err != nil {
+		return err
+	}
+
+	fmt.Printf("Config written to %s. Run quimby config validate to check it.\n", path)
+
+	return nil
+}
+
+func RunConfigView(cmd *cobra.Command, args []string) error {
+	conf, err := cli.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	y, err := yaml.Marshal(conf.Redacted())
+	if err != nil {
+		return err
+	}
+
+	if conf.Profile != "" {
+		fmt.Printf("# Profile %s applied\n", conf.Profile)
+	}
+	fmt.Print(string(y))
+
+	return nil
+}
+
+func RunConfigSet(cmd *cobra.Command, args []string) error {
+	key, value := args[0], args[1]
+	if !cli.ValidKey(key) {
+		return errors.Errorf("unknown config key: %s", key)
+	}
+
+	return cli.SetConfigValues(cli.Global.ConfigFile, map[string]interface{}{key: value})
+}
+
+func RunConfigValidate(cmd *cobra.Command, args []string) error {
+	ctx, cancel := cli.Context(cmd)
+	defer cancel()
+
+	conf, err := cli.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	rdr, err := conf.UncachedReader(ctx)
+	if err != nil {
+		return err
+	}
+
+	type check struct {
+		name  string
+		check func() error
+	}
+	var checks []check
+	if gh, ok := rdr.(*reader.Github); ok {
+		checks = append(checks, check{"GitHub repo is reachable", gh.Reachable})
+	}
+	checks = append(checks,
+		check{"Accelerators are valid", conf.ValidateAccelerators},
+		check{"Allowed kinds are valid", func() error {
+			_, err := conf.AllowedGroupVersionKinds()
+			return err
+		}},
+		check{"Default values exist", func() error {
+			_, err := rdr.Read(conf.ValuesPath())
+			return err
+		}},
+		check{"Quimby template exists", func() error {
+			_, err := rdr.Read(conf.TemplatePath())
+			return err
+		}},
+		check{"Cluster is reachable", func() error {
+			client, err := k8s.NewClient(conf.ClientOptions())
+			if err != nil {
+				return err
+			}
+			_, err = client.ServerVersion(ctx)
+			return err
+		}},
+	)
+
+	var rows [][]string
+	failed := 0
+	for _, c := range checks {
+		result := "ok"
+		if err := c.check(); err != nil {
+			result = "failed: " + err.Error()
+			failed++
+		}
+		rows = append(rows, []string{c.name, result})
+	}
+	cli.RenderTable([][]string{{"Check", "Result"}}, rows)
+
+	if failed > 0 {
+		return errors.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+
+	return nil
+}
+
+func RunUseProfile(cmd *cobra.Command, args []string) error {
+	name := args[0]
+
+	conf, err := cli.ParseConfig(cli.Global.ConfigFile, "")
+	if err != nil {
+		return err
+	}
+	if _, err := conf.WithProfile(name); err != nil {
+		return err
+	}
+
+	err = cli.SetConfigValues(cli.Global.ConfigFile, map[string]interface{}{"current-profile": name})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Switched to profile %s.\n", name)
+
+	return nil
+}
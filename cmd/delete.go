@@ -24,6 +24,9 @@ func newDeleteCmd() *cobra.Command {
 }
 
 func RunDelete(cmd *cobra.Command, args []string) error {
+	ctx, cancel := cli.Context(cmd)
+	defer cancel()
+
 	user := args[0]
 
 	// Validate input
@@ -31,12 +34,17 @@ func RunDelete(cmd *cobra.Command, args []string) error {
 		return errors.Errorf("invalid username: %s", user)
 	}
 
-	client, err := k8s.NewClient()
+	conf, err := cli.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	client, err := k8s.NewClient(conf.ClientOptions())
 	if err != nil {
 		return err
 	}
 
-	v, err := client.UserExists(user)
+	v, err := client.UserExists(ctx, user)
 	if err != nil {
 		return err
 	}
@@ -55,7 +63,7 @@ func RunDelete(cmd *cobra.Command, args []string) error {
 	}
 
 	// Do the dirty work and pray...
-	err = client.DeleteUser(user)
+	err = client.DeleteUser(ctx, user)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,138 @@
+package edit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/uitml/quimby/internal/cli"
+	"github.com/uitml/quimby/internal/k8s"
+	"github.com/uitml/quimby/internal/resource"
+	"github.com/uitml/quimby/internal/validate"
+)
+
+// Resolves the users an edit applies to: either the single user given as argument, or all users
+// matching the label selector.
+func targetUsers(ctx context.Context, client k8s.ResourceClient, args []string, selector string) ([]string, error) {
+	if len(args) > 0 && selector != "" {
+		return nil, errors.New("a username can not be combined with a selector")
+	}
+	if len(args) == 0 && selector == "" {
+		return nil, errors.New("either a username or a selector is required")
+	}
+
+	if len(args) > 0 {
+		username := args[0]
+		if !validate.Username(username) {
+			return nil, errors.Errorf("invalid username: %s", username)
+		}
+
+		u, err := client.UserExists(ctx, username)
+		if err != nil {
+			return nil, err
+		}
+		if !u {
+			return nil, fmt.Errorf("user %s does not exist", username)
+		}
+
+		return []string{username}, nil
+	}
+
+	namespaces, err := client.Users(ctx, selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(namespaces) == 0 {
+		return nil, errors.Errorf("no users match selector %s", selector)
+	}
+
+	var usernames []string
+	for _, ns := range namespaces {
+		usernames = append(usernames, ns.Name)
+	}
+
+	return usernames, nil
+}
+
+// Joins a selector with a requirement on the user type label.
+func withUsertype(selector string, usertype string) string {
+	if usertype == "" {
+		return selector
+	}
+
+	requirement := k8s.LabelUserType + "=" + usertype
+	if selector == "" {
+		return requirement
+	}
+
+	return selector + "," + requirement
+}
+
+// Formats changes as a single line.
+func formatChanges(changes []resource.Change) string {
+	if len(changes) == 0 {
+		return "unchanged"
+	}
+
+	var parts []string
+	for _, c := range changes {
+		parts = append(parts, c.Field+": "+c.Old+" -> "+c.New)
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// Renders the changes planned for each user.
+func renderPreview(usernames []string, changes map[string][]resource.Change) {
+	var rows [][]string
+	for _, u := range usernames {
+		rows = append(rows, []string{u, formatChanges(changes[u])})
+	}
+
+	cli.RenderTable([][]string{{"Username", "Changes"}}, rows)
+}
+
+// Renders the result of a bulk edit for each user. Returns an error if any of them failed.
+func renderResults(usernames []string, results map[string]error, skipped map[string]bool) error {
+	var rows [][]string
+	failed := 0
+	for _, u := range usernames {
+		switch {
+		case skipped[u]:
+			rows = append(rows, []string{u, "unchanged"})
+		case results[u] != nil:
+			rows = append(rows, []string{u, "failed: " + results[u].Error()})
+			failed++
+		default:
+			rows = append(rows, []string{u, "updated"})
+		}
+	}
+
+	cli.RenderTable([][]string{{"Username", "Result"}}, rows)
+
+	if failed > 0 {
+		return errors.Errorf("%d of %d users failed", failed, len(usernames))
+	}
+
+	return nil
+}
+
+// Describes a merge of the changes of an edit and changes made by someone else, for the header of
+// the editor. In conflicts, Old is the value of someone else and New the value of the edit.
+func mergeNote(conflicts []resource.Change) string {
+	var b strings.Builder
+	b.WriteString("This is a merge of your changes and the changes made by someone else during the edit.\n")
+	if len(conflicts) == 0 {
+		b.WriteString("None of them conflict, save the file unchanged to apply the merge.\n\n")
+		return b.String()
+	}
+
+	b.WriteString("These fields were changed by both, and have your value:\n")
+	for _, c := range conflicts {
+		fmt.Fprintf(&b, "  %s: yours %s, theirs %s\n", c.Field, c.New, c.Old)
+	}
+	b.WriteString("\n")
+
+	return b.String()
+}
@@ -1,62 +1,293 @@
 package edit
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/uitml/quimby/internal/cli"
 	"github.com/uitml/quimby/internal/k8s"
+	"github.com/uitml/quimby/internal/resource"
 	"github.com/uitml/quimby/internal/user"
-	"github.com/uitml/quimby/internal/validate"
 	"gopkg.in/yaml.v2"
 )
 
+var (
+	metaSelector       string
+	metaSelectUsertype string
+	metaYes            bool
+	metaForce          bool
+	metaFlags          user.Metadata
+)
+
 func NewMetaCmd() *cobra.Command {
 	var metaCmd = &cobra.Command{
-		Use:   "meta",
+		Use:   "meta [username]",
 		Short: "Edit a users metadata.",
-		Args:  cobra.ExactArgs(1),
+		Long: "Edit a users metadata.\n\n" +
+			"Without any field flags the metadata is edited in an editor. With field flags the\n" +
+			"values are set directly, either for a single user or for all users matching\n" +
+			"--selector and --select-usertype.",
+		Example: "  quimby edit meta foo123\n" +
+			"  quimby edit meta foo123 --email foo@uit.no\n" +
+			"  quimby edit meta --select-usertype student --usertype alumni --yes",
+		Args: cobra.MaximumNArgs(1),
 
 		RunE: RunMeta,
 	}
 
+	metaCmd.Flags().StringVar(&metaFlags.Fullname, "fullname", "", "Full name of the user.")
+	metaCmd.Flags().StringVar(&metaFlags.Email, "email", "", "E-mail address of the user.")
+	metaCmd.Flags().StringVar(&metaFlags.Usertype, "usertype", "", "User type, e.g. student, phd or staff.")
+	metaCmd.Flags().StringVarP(&metaSelector, "selector", "l", "", "Edit all users matching the label selector.")
+	metaCmd.Flags().StringVar(&metaSelectUsertype, "select-usertype", "", "Edit all users of the given user type.")
+	metaCmd.Flags().BoolVarP(&metaYes, "yes", "y", false, "Apply changes without asking for confirmation.")
+	metaCmd.Flags().BoolVar(&metaForce, "force-conflicts", false, "Take over fields owned by other field managers, e.g. changed with kubectl, without asking.")
+
 	return metaCmd
 }
 
 func RunMeta(cmd *cobra.Command, args []string) error {
-	username := args[0]
+	ctx, cancel := cli.Context(cmd)
+	defer cancel()
+
+	conf, err := cli.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	client, err := k8s.NewClient(conf.ClientOptions())
+	if err != nil {
+		return err
+	}
+
+	usernames, err := targetUsers(ctx, client, args, withUsertype(metaSelector, metaSelectUsertype))
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for _, name := range []string{"fullname", "email", "usertype"} {
+		changed = changed || cmd.Flags().Changed(name)
+	}
+	if !changed {
+		if len(args) == 0 {
+			return errors.New("editing multiple users requires at least one field flag")
+		}
+		return editMeta(ctx, client, conf, usernames[0])
+	}
+	if err := metaFlags.Validate(); err != nil {
+		return err
+	}
+
+	// Returns the metadata of a user with the values given as flags set
+	merged := func(md *user.Metadata) *user.Metadata {
+		m := *md
+		if cmd.Flags().Changed("fullname") {
+			m.Fullname = metaFlags.Fullname
+		}
+		if cmd.Flags().Changed("email") {
+			m.Email = metaFlags.Email
+		}
+		if cmd.Flags().Changed("usertype") {
+			m.Usertype = metaFlags.Usertype
+		}
+		return &m
+	}
+
+	if len(args) == 1 {
+		old, version, err := metadata(ctx, client, conf, usernames[0])
+		if err != nil {
+			return err
+		}
+		return updateMeta(ctx, client, conf, usernames[0], old, version, merged(old))
+	}
+
+	return bulkMeta(ctx, client, conf, usernames, merged)
+}
+
+// Returns the current metadata of a user, and the resourceVersion of the namespace it is read from.
+func metadata(ctx context.Context, client k8s.ResourceClient, conf *cli.App, username string) (*user.Metadata, string, error) {
+	ns, err := client.Namespace(ctx, username)
+	if err != nil {
+		return nil, "", err
+	}
+	u := user.FromNamespace(*ns, conf.EmailDomain)
+
+	return u.Metadata(), ns.ResourceVersion, nil
+}
+
+// Edits the metadata of a single user in an editor.
+func editMeta(ctx context.Context, client k8s.ResourceClient, conf *cli.App, username string) error {
+	old, version, err := metadata(ctx, client, conf, username)
+	if err != nil {
+		return err
+	}
+
+	return editMetadata(ctx, client, conf, username, old, version, old, "")
+}
 
-	// Validate input
-	if !validate.Username(username) {
-		return errors.Errorf("invalid username: %s", username)
+// Edits the metadata of a user in an editor, starting from start, and applies the result to old,
+// read at version. The edit is cancelled if nothing differs from old. note is added to the header.
+func editMetadata(ctx context.Context, client k8s.ResourceClient, conf *cli.App, username string, old *user.Metadata, version string, start *user.Metadata, note string) error {
+	original, err := yaml.Marshal(old)
+	if err != nil {
+		return err
+	}
+	y, err := yaml.Marshal(start)
+	if err != nil {
+		return err
 	}
 
-	client, err := k8s.NewClient()
+	r, err := cli.EditorFrom(original, y, metaHeader(username)+note, func(b []byte) error {
+		tmp := user.Metadata{}
+		if err := yaml.UnmarshalStrict(b, &tmp); err != nil {
+			return err
+		}
+		return tmp.Validate()
+	})
+	if errors.Is(err, cli.ErrEditCanceled) {
+		fmt.Println("Edit cancelled, no changes made.")
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
-	ns, err := client.Namespace(username)
+	md := *old
+	err = yaml.UnmarshalStrict(r, &md)
 	if err != nil {
 		return err
 	}
-	u := user.FromNamespace(*ns)
-	md := u.Metadata()
-	y, err := yaml.Marshal(md)
+
+	return updateMeta(ctx, client, conf, username, old, version, &md)
+}
+
+// Shows the changes to the metadata of a single user, and applies them once confirmed. If someone
+// else changed the user since old was read at version, a merge is offered instead.
+func updateMeta(ctx context.Context, client k8s.ResourceClient, conf *cli.App, username string, old *user.Metadata, version string, md *user.Metadata) error {
+	changes := old.Diff(md)
+	if len(changes) == 0 {
+		fmt.Println("No changes made.")
+		return nil
+	}
+	cli.RenderChanges(changes)
+	if !metaYes {
+		c, err := cli.Confirmation("Apply these changes to user "+username+"?", false)
+		if err != nil {
+			return err
+		}
+		if !c {
+			fmt.Printf("User %s not changed.\n", username)
+			return nil
+		}
+	}
+
+	current, currentVersion, err := metadata(ctx, client, conf, username)
 	if err != nil {
 		return err
 	}
+	if currentVersion != version {
+		return mergeMeta(ctx, client, conf, username, old, md, current, currentVersion)
+	}
+
+	return cli.ApplyConflicts(func(force bool) error {
+		return client.ApplyMetadata(ctx, username, md.Fullname, md.Email, md.Usertype, force)
+	}, metaForce, !metaYes)
+}
 
-	r, err := cli.Editor(y)
+// Shows the changes someone else made to the metadata of a user since old was read, and offers
+// to edit a merge of them and md. current was read at version.
+func mergeMeta(ctx context.Context, client k8s.ResourceClient, conf *cli.App, username string, old *user.Metadata, md *user.Metadata, current *user.Metadata, version string) error {
+	fmt.Printf("User %s was changed by someone else during the edit.\n", username)
+	if changes := old.Diff(current); len(changes) > 0 {
+		cli.RenderChanges(changes)
+	} else {
+		fmt.Println("None of the metadata fields changed.")
+	}
+	if metaYes {
+		return errors.Errorf("user %s was changed during the edit, no changes made", username)
+	}
+
+	c, err := cli.Confirmation("Edit a merge of your changes and the current metadata?", true)
 	if err != nil {
 		return err
 	}
+	if !c {
+		fmt.Printf("User %s not changed.\n", username)
+		return nil
+	}
+
+	merged, conflicts := user.MergeMetadata(old, md, current)
+
+	return editMetadata(ctx, client, conf, username, current, version, merged, mergeNote(conflicts))
+}
+
+// Applies merge to the metadata of all users, after showing a preview and asking for confirmation.
+func bulkMeta(ctx context.Context, client k8s.ResourceClient, conf *cli.App, usernames []string, merge func(*user.Metadata) *user.Metadata) error {
+	mds := make(map[string]*user.Metadata)
+	changes := make(map[string][]resource.Change)
+	versions := make(map[string]string)
+	for _, u := range usernames {
+		old, version, err := metadata(ctx, client, conf, u)
+		if err != nil {
+			return errors.Wrapf(err, "user %s", u)
+		}
+		mds[u], versions[u] = merge(old), version
+		changes[u] = old.Diff(mds[u])
+	}
 
-	err = yaml.Unmarshal(r, md)
+	renderPreview(usernames, changes)
+	if !metaYes {
+		c, err := cli.Confirmation(fmt.Sprintf("Apply these changes to %d users?", len(usernames)), false)
+		if err != nil {
+			return err
+		}
+		if !c {
+			fmt.Println("No users changed.")
+			return nil
+		}
+	}
+
+	results := make(map[string]error)
+	skipped := make(map[string]bool)
+	for _, u := range usernames {
+		if len(changes[u]) == 0 {
+			skipped[u] = true
+			continue
+		}
+		if results[u] = checkVersion(ctx, client, conf, u, versions[u]); results[u] != nil {
+			continue
+		}
+		md := mds[u]
+		results[u] = cli.ApplyConflicts(func(force bool) error {
+			return client.ApplyMetadata(ctx, u, md.Fullname, md.Email, md.Usertype, force)
+		}, metaForce, false)
+	}
+
+	return renderResults(usernames, results, skipped)
+}
+
+// Returns an error if the namespace of a user changed since version.
+func checkVersion(ctx context.Context, client k8s.ResourceClient, conf *cli.App, username string, version string) error {
+	_, current, err := metadata(ctx, client, conf, username)
 	if err != nil {
 		return err
 	}
+	if current != version {
+		return errors.Errorf("changed by someone else during the edit: Namespace %s", username)
+	}
 
-	err = client.ApplyMetadata(username, md.Fullname, md.Email, md.Usertype)
+	return nil
+}
 
-	return err
+func metaHeader(username string) string {
+	return "Editing the metadata of user " + username + ".\n" +
+		"Lines beginning with '#' are ignored, and an empty or unchanged file aborts the edit.\n" +
+		"\n" +
+		"  fullname  Full name of the user\n" +
+		"  email     E-mail address of the user\n" +
+		"  usertype  User type, e.g. student, phd or staff\n" +
+		"\n"
 }
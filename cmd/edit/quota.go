@@ -1,8 +1,12 @@
 package edit
 
 import (
+	"context"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/uitml/quimby/internal/cli"
@@ -10,89 +14,583 @@ import (
 	"github.com/uitml/quimby/internal/resource"
 	"github.com/uitml/quimby/internal/user"
 	"github.com/uitml/quimby/internal/user/reader"
-	"github.com/uitml/quimby/internal/validate"
 	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
 )
 
+var (
+	quotaSelector       string
+	quotaSelectUsertype string
+	quotaYes            bool
+	quotaForce          bool
+	quotaFlags          resource.Spec
+
+	// How long to wait for a storage volume to be expanded
+	resizeTimeout = 5 * time.Minute
+)
+
+// Flag value setting a single field of a Spec, accepting quantities in the unit of the field.
+type specValue struct {
+	field resource.Field
+	spec  *resource.Spec
+}
+
+func (v *specValue) String() string {
+	if p := v.field.Get(v.spec); p != nil {
+		return fmt.Sprint(*p)
+	}
+	return ""
+}
+
+func (v *specValue) Set(s string) error {
+	n, err := v.field.Unit.Parse(s)
+	if err != nil {
+		return err
+	}
+	v.field.Set(v.spec, &n)
+	return nil
+}
+
+func (v *specValue) Type() string {
+	return "quantity"
+}
+
+// Flag value setting the quota of an accelerator of a Spec, given as name=count.
+type acceleratorValue struct {
+	spec *resource.Spec
+}
+
+func (v *acceleratorValue) String() string {
+	var values []string
+	for _, name := range resource.AcceleratorNames(v.spec) {
+		values = append(values, fmt.Sprintf("%s=%d", name, v.spec.Accelerators[name]))
+	}
+	return strings.Join(values, ",")
+}
+
+func (v *acceleratorValue) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 {
+		return errors.Errorf("invalid accelerator %q, want name=count", s)
+	}
+	n, err := resource.UnitDevices.Parse(parts[1])
+	if err != nil {
+		return err
+	}
+	if v.spec.Accelerators == nil {
+		v.spec.Accelerators = make(map[corev1.ResourceName]int64)
+	}
+	v.spec.Accelerators[corev1.ResourceName(parts[0])] = n
+	return nil
+}
+
+func (v *acceleratorValue) Type() string {
+	return "name=count"
+}
+
+// Flag value setting the GPU models of a Spec, given as a comma separated list. An empty value
+// allows all models.
+type gpuModelsValue struct {
+	spec *resource.Spec
+}
+
+func (v *gpuModelsValue) String() string {
+	return strings.Join(v.spec.GPUModels, ",")
+}
+
+func (v *gpuModelsValue) Set(s string) error {
+	models := []string{}
+	for _, m := range strings.Split(s, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			models = append(models, m)
+		}
+	}
+	v.spec.GPUModels = models
+	return nil
+}
+
+func (v *gpuModelsValue) Type() string {
+	return "models"
+}
+
 func NewQuotaCmd() *cobra.Command {
 	var quotaCmd = &cobra.Command{
-		Use:   "quota",
+		Use:   "quota [username]",
 		Short: "Edit a users resource quota.",
-		Args:  cobra.ExactArgs(1),
+		Long: "Edit a users resource quota.\n\n" +
+			"Without any field flags the quota is edited in an editor. With field flags the\n" +
+			"values are set directly, either for a single user or for all users matching\n" +
+			"--selector and --select-usertype.\n\n" +
+			"Fields in lockedfields for every admin group you are in cannot be changed. Your groups\n" +
+			"are read from the cluster with a SelfSubjectReview, which requires Kubernetes 1.27\n" +
+			"or later if lockedfields is set.",
+		Example: "  quimby edit quota foo123\n" +
+			"  quimby edit quota foo123 --gpu 4 --max-memory-per-job 32Gi\n" +
+			"  quimby edit quota foo123 --accelerator nvidia.com/mig-1g.10gb=2\n" +
+			"  quimby edit quota foo123 --gpu-models NVIDIA-A100-SXM4-40GB\n" +
+			"  quimby edit quota --select-usertype phd --storage-size 1Ti --yes",
+		Args: cobra.MaximumNArgs(1),
 
 		RunE: RunQuota,
 	}
 
+	for _, f := range resource.SpecFields {
+		quotaCmd.Flags().Var(&specValue{field: f, spec: &quotaFlags}, f.Flag, f.Description+" ("+f.Unit.Name+")")
+	}
+	quotaCmd.Flags().Var(&acceleratorValue{spec: &quotaFlags}, "accelerator", "Quota of an accelerator from the config, e.g. nvidia.com/mig-1g.10gb=2. Can be repeated.")
+	quotaCmd.Flags().Var(&gpuModelsValue{spec: &quotaFlags}, "gpu-models", "GPU product the jobs may run on, as given by the "+k8s.LabelGPUProduct+" node label. Empty allows all, and only one can be enforced.")
+	quotaCmd.Flags().StringVarP(&quotaSelector, "selector", "l", "", "Edit all users matching the label selector.")
+	quotaCmd.Flags().StringVar(&quotaSelectUsertype, "select-usertype", "", "Edit all users of the given user type.")
+	quotaCmd.Flags().DurationVar(&resizeTimeout, "wait-timeout", resizeTimeout, "How long to wait for the storage volume to be expanded.")
+	quotaCmd.Flags().BoolVarP(&quotaYes, "yes", "y", false, "Apply changes without asking for confirmation.")
+	quotaCmd.Flags().BoolVar(&quotaForce, "force-conflicts", false, "Take over fields owned by other field managers, e.g. changed with kubectl, without asking.")
+
 	return quotaCmd
 }
 
 func RunQuota(cmd *cobra.Command, args []string) error {
-	username := args[0]
+	ctx, cancel := cli.Context(cmd)
+	defer cancel()
 
-	// Validate input
-	if !validate.Username(username) {
-		return errors.Errorf("invalid username: %s", username)
+	conf, err := cli.LoadConfig()
+	if err != nil {
+		return err
 	}
 
-	client, err := k8s.NewClient()
+	client, err := k8s.NewClient(conf.ClientOptions())
 	if err != nil {
 		return err
 	}
+	if len(conf.LockedFields) > 0 {
+		if conf.Groups, err = client.Groups(ctx); err != nil {
+			return errors.Wrap(err, "reading your groups for lockedfields")
+		}
+	}
 
-	u, err := client.UserExists(username)
+	usernames, err := targetUsers(ctx, client, args, withUsertype(quotaSelector, quotaSelectUsertype))
 	if err != nil {
 		return err
 	}
-	if !u {
-		return fmt.Errorf("user %s does not exist", username)
+
+	flags := quotaFlags.DeepCopy()
+	if len(resource.DiffSpec(&resource.Spec{}, flags)) == 0 && flags.GPUModels == nil {
+		if len(args) == 0 {
+			return errors.New("editing multiple users requires at least one field flag")
+		}
+		return editQuota(ctx, client, conf, usernames[0])
+	}
+	if err := checkLocked(conf, flags); err != nil {
+		return err
+	}
+	if err := checkAccelerators(conf, flags); err != nil {
+		return err
+	}
+	if err := flags.Validate(); err != nil {
+		return err
+	}
+
+	if len(args) == 1 {
+		spec, versions, err := client.VersionedSpec(ctx, usernames[0])
+		if err != nil {
+			return err
+		}
+		return updateQuota(ctx, client, conf, usernames[0], spec, versions, mergeSpec(spec, flags))
+	}
+
+	return bulkQuota(ctx, client, conf, usernames, flags)
+}
+
+// Returns an error if any field locked for the admin groups of the user is set in spec.
+func checkLocked(conf *cli.App, spec *resource.Spec) error {
+	groups := strings.Join(conf.AdminGroups(), ", ")
+	for _, f := range resource.SpecFields {
+		if f.Get(spec) != nil && conf.Locked(f.Key) {
+			return errors.Errorf("%s: field is locked for admin group %s", f.Key, groups)
+		}
+	}
+	if len(spec.Accelerators) > 0 && conf.Locked("accelerators") {
+		return errors.Errorf("accelerators: field is locked for admin group %s", groups)
+	}
+	if spec.GPUModels != nil && conf.Locked(resource.GPUModelsKey) {
+		return errors.Errorf("%s: field is locked for admin group %s", resource.GPUModelsKey, groups)
+	}
+
+	return nil
+}
+
+// Returns an error if spec sets the quota of an accelerator that is not in the config, as it
+// would not be read back from the cluster.
+func checkAccelerators(conf *cli.App, spec *resource.Spec) error {
+	configured := make(map[corev1.ResourceName]bool)
+	for _, name := range conf.AcceleratorResources() {
+		configured[name] = true
+	}
+	for _, name := range resource.AcceleratorNames(spec) {
+		if !configured[name] {
+			return errors.Errorf("%s: accelerator is not in the accelerators of the config", resource.AcceleratorKey(name))
+		}
+	}
+
+	return nil
+}
+
+// Returns a copy of spec with all values set in flags overridden.
+func mergeSpec(spec *resource.Spec, flags *resource.Spec) *resource.Spec {
+	merged := spec.DeepCopy()
+	for _, f := range resource.SpecFields {
+		if v := f.Get(flags); v != nil {
+			f.Set(merged, v)
+		}
+	}
+	for name, v := range flags.Accelerators {
+		if merged.Accelerators == nil {
+			merged.Accelerators = make(map[corev1.ResourceName]int64)
+		}
+		merged.Accelerators[name] = v
+	}
+	if flags.GPUModels != nil {
+		merged.GPUModels = append([]string{}, flags.GPUModels...)
 	}
 
+	return merged
+}
+
+// Edits the quota of a single user in an editor. Fields locked for the admin groups are
+// shown, but can not be changed.
+func editQuota(ctx context.Context, client k8s.ResourceClient, conf *cli.App, username string) error {
 	// Get current values
-	spec, err := client.Spec(username)
+	spec, versions, err := client.VersionedSpec(ctx, username)
 	if err != nil {
 		return err
 	}
 
-	// Selecting which values are allowed to be edited...
-	tmpSpec := resource.Spec{
-		GPU:                 spec.GPU,
-		MaxMemoryPerJob:     spec.MaxMemoryPerJob,
-		DefaultMemoryPerJob: spec.DefaultMemoryPerJob,
+	return editSpec(ctx, client, conf, username, spec, versions, spec, "")
+}
+
+// Returns a copy of spec without the fields locked for the admin groups.
+func editableSpec(conf *cli.App, spec *resource.Spec) *resource.Spec {
+	editable := spec.DeepCopy()
+	for _, f := range resource.SpecFields {
+		if conf.Locked(f.Key) {
+			f.Set(editable, nil)
+		}
+	}
+	if conf.Locked("accelerators") {
+		editable.Accelerators = nil
+	}
+	if conf.Locked(resource.GPUModelsKey) {
+		editable.GPUModels = nil
+	}
+
+	return editable
+}
+
+// Edits the quota of a user in an editor, starting from start, and applies the result to spec,
+// read at versions. The edit is cancelled if nothing differs from spec. note is added to the
+// header.
+func editSpec(ctx context.Context, client k8s.ResourceClient, conf *cli.App, username string, spec *resource.Spec, versions k8s.Versions, start *resource.Spec, note string) error {
+	original, err := yaml.Marshal(editableSpec(conf, spec))
+	if err != nil {
+		return err
+	}
+	s, err := yaml.Marshal(editableSpec(conf, start))
+	if err != nil {
+		return err
 	}
 
 	// Edit values
-	s, err := yaml.Marshal(tmpSpec)
+	es, err := cli.EditorFrom(original, s, quotaHeader(username, spec, conf)+note, func(b []byte) error {
+		tmp := resource.Spec{}
+		if err := yaml.UnmarshalStrict(b, &tmp); err != nil {
+			return err
+		}
+		if err := checkLocked(conf, &tmp); err != nil {
+			return err
+		}
+		if err := checkAccelerators(conf, &tmp); err != nil {
+			return err
+		}
+		return tmp.Validate()
+	})
+	if errors.Is(err, cli.ErrEditCanceled) {
+		fmt.Println("Edit cancelled, no changes made.")
+		return nil
+	}
 	if err != nil {
 		return err
 	}
-	es, err := cli.Editor(s)
+	edited := resource.Spec{}
+	err = yaml.UnmarshalStrict(es, &edited)
 	if err != nil {
 		return err
 	}
-	err = yaml.Unmarshal(es, spec)
+
+	return updateQuota(ctx, client, conf, username, spec, versions, mergeSpec(spec, &edited))
+}
+
+// Shows the changes to the quota of a single user, and applies them once confirmed. If someone
+// else changed the user since old was read at versions, a merge is offered instead.
+func updateQuota(ctx context.Context, client k8s.ResourceClient, conf *cli.App, username string, old *resource.Spec, versions k8s.Versions, new *resource.Spec) error {
+	if len(resource.DiffSpec(old, new)) == 0 {
+		fmt.Println("No changes made.")
+		return nil
+	}
+	if err := checkStorage(username, old, new); err != nil {
+		return err
+	}
+
+	c, err := confirmQuota(ctx, client, username, old, new)
+	if err != nil {
+		return err
+	}
+	if !c {
+		fmt.Printf("User %s not changed.\n", username)
+		return nil
+	}
+
+	current, currentVersions, err := client.VersionedSpec(ctx, username)
+	if err != nil {
+		return err
+	}
+	changed := versions.Changed(currentVersions)
+	if len(changed) > 0 || len(resource.DiffSpec(old, current)) > 0 {
+		return mergeQuota(ctx, client, conf, username, old, new, current, currentVersions, changed)
+	}
+
+	rdr, err := conf.Reader(ctx)
+	if err != nil {
+		return err
+	}
+	template := conf.TemplatePath()
+
+	return applySpec(ctx, client, rdr, template, username, old, new, !quotaYes)
+}
+
+// Shows the changes someone else made to the quota of a user since old was read, and offers to
+// edit a merge of them and new. current was read at versions, after the objects in changed were
+// changed, if any.
+func mergeQuota(ctx context.Context, client k8s.ResourceClient, conf *cli.App, username string, old *resource.Spec, new *resource.Spec, current *resource.Spec, versions k8s.Versions, changed []string) error {
+	if len(changed) > 0 {
+		fmt.Printf("User %s was changed by someone else during the edit: %s.\n", username, strings.Join(changed, ", "))
+	} else {
+		fmt.Printf("User %s was changed by someone else during the edit.\n", username)
+	}
+	if changes := resource.DiffSpec(old, current); len(changes) > 0 {
+		cli.RenderChanges(changes)
+	} else {
+		fmt.Println("None of the quota fields changed.")
+	}
+	if quotaYes {
+		return errors.Errorf("user %s was changed during the edit, no changes made", username)
+	}
+
+	c, err := cli.Confirmation("Edit a merge of your changes and the current quota?", true)
 	if err != nil {
 		return err
 	}
+	if !c {
+		fmt.Printf("User %s not changed.\n", username)
+		return nil
+	}
+
+	merged, conflicts := resource.MergeSpec(old, new, current)
+
+	return editSpec(ctx, client, conf, username, current, versions, merged, mergeNote(conflicts))
+}
+
+// Returns an error if the quota of a user changed since old was read at versions, or any of the
+// objects it was read from.
+func checkVersions(ctx context.Context, client k8s.ResourceClient, username string, old *resource.Spec, versions k8s.Versions) error {
+	current, currentVersions, err := client.VersionedSpec(ctx, username)
+	if err != nil {
+		return err
+	}
+	if changed := versions.Changed(currentVersions); len(changed) > 0 {
+		return errors.Errorf("changed by someone else during the edit: %s", strings.Join(changed, ", "))
+	}
+	if changes := resource.DiffSpec(old, current); len(changes) > 0 {
+		fields := make([]string, len(changes))
+		for i, c := range changes {
+			fields[i] = c.Field
+		}
+		return errors.Errorf("quota changed by someone else during the edit: %s", strings.Join(fields, ", "))
+	}
+
+	return nil
+}
+
+// Applies the values set in flags to all users, after showing a preview and asking for confirmation.
+func bulkQuota(ctx context.Context, client k8s.ResourceClient, conf *cli.App, usernames []string, flags *resource.Spec) error {
+	specs, olds := make(map[string]*resource.Spec), make(map[string]*resource.Spec)
+	versions := make(map[string]k8s.Versions)
+	changes := make(map[string][]resource.Change)
+	for _, u := range usernames {
+		spec, v, err := client.VersionedSpec(ctx, u)
+		if err != nil {
+			return errors.Wrapf(err, "user %s", u)
+		}
+		olds[u], specs[u], versions[u] = spec, mergeSpec(spec, flags), v
+		changes[u] = resource.DiffSpec(spec, specs[u])
+		if err := checkStorage(u, spec, specs[u]); err != nil {
+			return err
+		}
+	}
+
+	renderPreview(usernames, changes)
+	if !quotaYes {
+		c, err := cli.Confirmation(fmt.Sprintf("Apply these changes to %d users?", len(usernames)), false)
+		if err != nil {
+			return err
+		}
+		if !c {
+			fmt.Println("No users changed.")
+			return nil
+		}
+	}
 
-	// Populate manifests
-	conf, err := cli.ParseConfig()
+	rdr, err := conf.Reader(ctx)
 	if err != nil {
 		return err
 	}
+	template := conf.TemplatePath()
 
-	rdr := reader.Github{
-		Username: conf.GithubUser,
-		Token:    conf.GithubToken,
-		Repo:     conf.GithubRepo,
+	results := make(map[string]error)
+	skipped := make(map[string]bool)
+	for _, u := range usernames {
+		if len(changes[u]) == 0 {
+			skipped[u] = true
+			continue
+		}
+		if results[u] = checkVersions(ctx, client, u, olds[u], versions[u]); results[u] == nil {
+			results[u] = applySpec(ctx, client, rdr, template, u, olds[u], specs[u], false)
+		}
 	}
-	usrConf := user.Config{Username: username, Spec: spec}
-	k8sUser, err := user.GenerateConfig(conf.GithubConfigDir+"/default-user-quimby.yaml", &rdr, usrConf)
+
+	return renderResults(usernames, results, skipped)
+}
+
+// Populates the user template with spec and the current metadata of the user, and applies it.
+// The metadata is rendered, as server-side apply would remove it from the namespace otherwise,
+// where quimby created it with the template. On field manager conflicts, the user is asked
+// whether to take over the fields if prompt is set. The storage volume is expanded if it has
+// grown since old, once a dry run of the apply succeeds, as volumes can not shrink back.
+func applySpec(ctx context.Context, client k8s.ResourceClient, rdr reader.Config, template string, username string, old *resource.Spec, spec *resource.Spec, prompt bool) error {
+	cluster, err := client.Cluster(ctx)
 	if err != nil {
 		return err
 	}
+	ns, err := client.Namespace(ctx, username)
+	if err != nil {
+		return err
+	}
+	usrConf := user.Config{Username: username, Metadata: user.NamespaceMetadata(*ns), Spec: spec, Cluster: cluster}
+	k8sUser, err := user.GenerateConfig(template, rdr, usrConf)
+	if err != nil {
+		return err
+	}
+
+	force := quotaForce
+	err = cli.ApplyConflicts(func(f bool) error {
+		force = f
+		return client.DryRunApply(ctx, username, k8sUser, f)
+	}, quotaForce, prompt)
+	if err != nil {
+		return err
+	}
+
+	if o, n := old.StorageSize, spec.StorageSize; o != nil && n != nil && *n > *o {
+		fmt.Printf("Expanding the storage of user %s to %d GiB...\n", username, *n)
+		err := client.ResizeStorage(ctx, username, *resource.UnitGiB.Quantity(*n), resizeTimeout)
+		if err != nil {
+			return err
+		}
+	}
+
+	return client.Apply(ctx, username, k8sUser, force)
+}
+
+// Returns an error if the storage would shrink from old to new.
+func checkStorage(username string, old *resource.Spec, new *resource.Spec) error {
+	if o, n := old.StorageSize, new.StorageSize; o != nil && n != nil && *n < *o {
+		return errors.Errorf("can not shrink the storage of user %s from %d GiB to %d GiB, volumes can only be expanded", username, *o, *n)
+	}
+
+	return nil
+}
+
+// Shows the changes from old to new, including the resulting Kubernetes resources, and asks
+// the user to confirm them. Warns if the new quota is lower than what is currently in use.
+func confirmQuota(ctx context.Context, client k8s.ResourceClient, username string, old *resource.Spec, new *resource.Spec) (bool, error) {
+	changes := resource.DiffSpec(old, new)
+
+	oldDerived, newDerived := k8s.DerivedResources(old), k8s.DerivedResources(new)
+	oldValues, newValues := make(map[string]string), make(map[string]string)
+	for _, key := range k8s.DerivedResourceKeys {
+		o, n := oldDerived[key], newDerived[key]
+		oldValues[key], newValues[key] = o.String(), n.String()
+	}
+	changes = append(changes, resource.Diff(k8s.DerivedResourceKeys, oldValues, newValues)...)
+	cli.RenderChanges(changes)
 
-	// Apply updates
-	err = client.Apply(username, k8sUser)
+	quota, err := client.Quota(ctx, username)
+	if err != nil {
+		return false, err
+	}
+	gpu, memory := newDerived[k8s.DerivedQuotaGPU], newDerived[k8s.DerivedQuotaMemory]
+	if gpu.Value() < quota.GPU.Used {
+		fmt.Printf("Warning: user %s currently uses %d GPUs, which is more than the new quota of %d.\n",
+			username, quota.GPU.Used, gpu.Value())
+	}
+	if memory.Value() < quota.Memory.Used {
+		fmt.Printf("Warning: user %s currently uses %s memory, which is more than the new quota of %s.\n",
+			username, humanize.IBytes(uint64(quota.Memory.Used)), humanize.IBytes(uint64(memory.Value())))
+	}
+	for _, name := range resource.AcceleratorNames(new) {
+		if n, used := new.Accelerators[name], quota.Accelerators[name].Used; n < used {
+			fmt.Printf("Warning: user %s currently uses %d of %s, which is more than the new quota of %d.\n",
+				username, used, name, n)
+		}
+	}
+
+	if quotaYes {
+		return true, nil
+	}
+
+	return cli.Confirmation("Apply these changes to user "+username+"?", false)
+}
+
+func quotaHeader(username string, spec *resource.Spec, conf *cli.App) string {
+	var b strings.Builder
+	b.WriteString("Editing the resource quota of user " + username + ".\n")
+	b.WriteString("Lines beginning with '#' are ignored, and an empty or unchanged file aborts the edit.\n")
+	b.WriteString("Values are quantities such as 32Gi or 500m, plain numbers are in the unit of the field.\n\n")
+	for _, f := range resource.SpecFields {
+		fmt.Fprintf(&b, "  %-24s%s (%s)\n", f.Key, f.Description, f.Unit.Name)
+	}
+	fmt.Fprintf(&b, "  %-24s%s\n", resource.GPUModelsKey, "GPU product the jobs may run on, at most one, all if empty")
+	if names := conf.Accelerators; len(names) > 0 {
+		fmt.Fprintf(&b, "  %-24s%s\n", "accelerators", "Quota of each accelerator by resource name, one of "+strings.Join(names, ", "))
+	}
+
+	var locked []string
+	for _, f := range resource.SpecFields {
+		if v := f.Get(spec); v != nil && conf.Locked(f.Key) {
+			locked = append(locked, fmt.Sprintf("  %s: %s", f.Key, f.Unit.Format(*v)))
+		}
+	}
+	if len(spec.Accelerators) > 0 && conf.Locked("accelerators") {
+		for _, name := range resource.AcceleratorNames(spec) {
+			locked = append(locked, fmt.Sprintf("  %s: %d", resource.AcceleratorKey(name), spec.Accelerators[name]))
+		}
+	}
+	if spec.GPUModels != nil && conf.Locked(resource.GPUModelsKey) {
+		locked = append(locked, fmt.Sprintf("  %s: %s", resource.GPUModelsKey, resource.FormatGPUModels(spec.GPUModels)))
+	}
+	if len(locked) > 0 {
+		b.WriteString("\nRead-only, locked for admin group " + strings.Join(conf.AdminGroups(), ", ") + ":\n")
+		b.WriteString(strings.Join(locked, "\n") + "\n")
+	}
+	b.WriteString("\n")
 
-	return err
+	return b.String()
 }
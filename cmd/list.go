@@ -1,16 +1,25 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strings"
 
+	"github.com/dustin/go-humanize"
 	"github.com/uitml/quimby/internal/cli"
 	"github.com/uitml/quimby/internal/k8s"
+	"github.com/uitml/quimby/internal/resource"
 	"github.com/uitml/quimby/internal/user"
+	corev1 "k8s.io/api/core/v1"
 
 	"github.com/spf13/cobra"
 )
 
-var listResources bool
+var (
+	listResources   bool
+	listAllProfiles bool
+)
 
 // listCmd represents the list command
 func newListCmd() *cobra.Command {
@@ -22,38 +31,136 @@ func newListCmd() *cobra.Command {
 	}
 
 	listCmd.Flags().BoolVarP(&listResources, "show-resources", "r", false, "Show resources for all users.")
+	listCmd.Flags().BoolVar(&listAllProfiles, "all-profiles", false, "List users on the clusters of all profiles, each with the context of its profile.")
 
 	return listCmd
 }
 
 func RunList(cmd *cobra.Command, args []string) error {
-	client, err := k8s.NewClient()
+	ctx, cancel := cli.Context(cmd)
+	defer cancel()
+
+	conf, err := cli.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	if listAllProfiles {
+		// Each profile names its own cluster, a single context would list one cluster many times
+		if cli.Global.Context != "" {
+			return fmt.Errorf("--all-profiles cannot be combined with --context")
+		}
+		return listProfiles(ctx, conf)
+	}
+
+	accelerators := conf.AcceleratorResources()
+	client, err := k8s.NewClient(conf.ClientOptions())
 	var footer [][]string
 
 	if err != nil {
 		return err
 	}
 
-	userList, err := user.PopulateList(client, listResources)
+	userList, err := user.PopulateList(ctx, client, listResources, conf.EmailDomain)
 
 	if err != nil {
 		return err
 	}
 
 	if listResources {
-		footer, err = makeFooter(userList, client)
+		footer, err = makeFooter(ctx, userList, client, "Total:", accelerators)
 
 		if err != nil {
 			return err
 		}
 	}
 
-	err = renderUsers(userList, footer)
+	headers, userTable, err := userTable(userList, accelerators)
+	if err != nil {
+		return err
+	}
+
+	if listResources {
+		cli.RenderTable(headers, userTable, footer)
+	} else {
+		cli.RenderTable(headers, userTable)
+	}
 
-	return err
+	return nil
 }
 
-func renderUsers(userList []user.User, footer [][]string) error {
+// Lists the users on the clusters of all profiles, with a column for the profile of each user.
+func listProfiles(ctx context.Context, conf *cli.App) error {
+	names := conf.ProfileNames()
+	if len(names) == 0 {
+		return fmt.Errorf("no profiles configured")
+	}
+
+	// The accelerators of all profiles are shown, so that the columns line up
+	var accelerators []corev1.ResourceName
+	seen := make(map[corev1.ResourceName]bool)
+	for _, name := range names {
+		pconf, err := conf.WithProfile(name)
+		if err != nil {
+			return err
+		}
+		for _, a := range pconf.AcceleratorResources() {
+			if !seen[a] {
+				seen[a] = true
+				accelerators = append(accelerators, a)
+			}
+		}
+	}
+
+	var headers, table, footer [][]string
+	for _, name := range names {
+		pconf, err := conf.WithProfile(name)
+		if err != nil {
+			return err
+		}
+
+		opts := pconf.ClientOptions()
+		opts.Accelerators = accelerators
+		client, err := k8s.NewClient(opts)
+		if err != nil {
+			return err
+		}
+
+		userList, err := user.PopulateList(ctx, client, listResources, pconf.EmailDomain)
+		if err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+
+		h, t, err := userTable(userList, accelerators)
+		if err != nil {
+			return err
+		}
+		headers = [][]string{append([]string{"Cluster"}, h[0]...)}
+		for _, row := range t {
+			table = append(table, append([]string{name}, row...))
+		}
+
+		if listResources {
+			f, err := makeFooter(ctx, userList, client, "Total ("+name+"):", accelerators)
+			if err != nil {
+				return err
+			}
+			for _, row := range f {
+				footer = append(footer, append([]string{""}, row...))
+			}
+		}
+	}
+
+	if listResources {
+		cli.RenderTable(headers, table, footer)
+	} else {
+		cli.RenderTable(headers, table)
+	}
+
+	return nil
+}
+
+func userTable(userList []user.User, accelerators []corev1.ResourceName) ([][]string, [][]string, error) {
 	headers := [][]string{
 		{
 			"Username",
@@ -64,42 +171,72 @@ func renderUsers(userList []user.User, footer [][]string) error {
 	}
 
 	if listResources {
-		headers[0] = append(headers[0], "GPU", "Mem/GPU", "Storage")
+		headers[0] = append(headers[0], "GPU")
+		for _, name := range accelerators {
+			headers[0] = append(headers[0], acceleratorHeader(name))
+		}
+		headers[0] = append(headers[0], "CPU", "Memory", "Mem/GPU", "Storage")
 	}
 
-	userTable, err := user.ListToTable(userList, listResources)
+	userTable, err := user.ListToTable(userList, listResources, accelerators)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	if listResources {
-		cli.RenderTable(headers, userTable, footer)
-	} else {
-		cli.RenderTable(headers, userTable)
-	}
+	return headers, userTable, nil
+}
 
-	return nil
+// Returns the column header of an accelerator, its resource name without the domain.
+func acceleratorHeader(name corev1.ResourceName) string {
+	n := string(name)
+	return n[strings.LastIndex(n, "/")+1:]
 }
 
-func makeFooter(userList []user.User, client k8s.ResourceClient) ([][]string, error) {
-	GPUSummary, err := client.TotalGPUs()
+func makeFooter(ctx context.Context, userList []user.User, client k8s.ResourceClient, title string, accelerators []corev1.ResourceName) ([][]string, error) {
+	capacity, err := client.TotalGPUs(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	resourceUsage := user.TotalResourcesUsed(userList)
 
-	footer := [][]string{
-		{
-			"",
-			"",
-			"",
-			"Total:",
-			fmt.Sprint(resourceUsage[k8s.ResourceGPU]) + "/" + fmt.Sprint(GPUSummary.Max),
-			"",
-			"",
-		},
+	row := []string{
+		"",
+		"",
+		"",
+		title,
+	}
+	for _, name := range append([]corev1.ResourceName{resource.ResourceGPU}, accelerators...) {
+		row = append(row, fmt.Sprint(resourceUsage[name])+"/"+fmt.Sprint(capacity.Resources[name].Max))
+	}
+	row = append(row,
+		resource.UnitMillicores.Format(resourceUsage[corev1.ResourceCPU]),
+		humanize.IBytes(uint64(resourceUsage[corev1.ResourceMemory])),
+		"",
+		"",
+	)
+	footer := [][]string{row}
+
+	// GPUs of each model, in the GPU column
+	for _, model := range gpuModels(capacity) {
+		r := make([]string, len(row))
+		r[3], r[4] = "  "+model, fmt.Sprint(capacity.GPUModels[model])
+		if model == "" {
+			r[3] = "  unlabeled"
+		}
+		footer = append(footer, r)
 	}
 
 	return footer, nil
 }
+
+// Returns the GPU models of the capacity, sorted.
+func gpuModels(capacity resource.Capacity) []string {
+	var models []string
+	for m := range capacity.GPUModels {
+		models = append(models, m)
+	}
+	sort.Strings(models)
+
+	return models
+}
@@ -10,59 +10,87 @@ import (
 	"github.com/uitml/quimby/internal/cli"
 	"github.com/uitml/quimby/internal/k8s"
 	"github.com/uitml/quimby/internal/user"
-	"github.com/uitml/quimby/internal/user/reader"
 	"github.com/uitml/quimby/internal/validate"
 
 	"github.com/spf13/cobra"
 )
 
+var (
+	newUsertype string
+	newForce    bool
+)
+
 // listCmd represents the list command
 func newCreateCmd() *cobra.Command {
 	var createCmd = &cobra.Command{
 		Use:   "new",
 		Short: "Create a new Springfield user.",
-		Args:  cobra.ExactArgs(1),
+		Long: "Create a new Springfield user.\n\n" +
+			"The values of the user are merged from default-user.yaml, usertypes/<usertype>.yaml and\n" +
+			"users/<username>.yaml in the values directory, where later files override earlier ones.",
+		Example: "  quimby new foo123\n  quimby new foo123 --usertype phd",
+		Args:    cobra.ExactArgs(1),
 
 		RunE: RunNew,
 	}
 
+	createCmd.Flags().StringVar(&newUsertype, "usertype", "", "User type, selecting the values in usertypes/<usertype>.yaml.")
+	createCmd.Flags().BoolVar(&newForce, "force-conflicts", false, "Take over fields owned by other field managers, e.g. changed with kubectl, without asking.")
+
 	return createCmd
 }
 
 func RunNew(cmd *cobra.Command, args []string) error {
+	ctx, cancel := cli.Context(cmd)
+	defer cancel()
+
 	username := args[0]
 	if !validate.Username(username) {
 		return fmt.Errorf("invalid username: %s", username)
 	}
 
-	conf, err := cli.ParseConfig()
+	conf, err := cli.LoadConfig()
 	if err != nil {
 		return err
 	}
 
-	// Get default values (on github please)
-	rdr := reader.Github{
-		Username: conf.GithubUser,
-		Token:    conf.GithubToken,
-		Repo:     conf.GithubRepo,
+	// Get default values from the template source
+	rdr, err := conf.Reader(ctx)
+	if err != nil {
+		return err
+	}
+	layers, err := user.ValueLayers(conf.ValuesPath(), newUsertype, username)
+	if err != nil {
+		return err
 	}
 	usrConf := user.Config{Username: username}
-	err = usrConf.Populate(conf.GithubValueDir+"/default-user.yaml", &rdr)
+	_, err = usrConf.PopulateLayers(layers, rdr)
 	if err != nil {
 		return err
 	}
+	if newUsertype != "" {
+		if usrConf.Metadata == nil {
+			usrConf.Metadata = &user.Metadata{}
+		}
+		usrConf.Usertype = newUsertype
+	}
 
-	// Generate k8s user config from template
-	k8sUser, err := user.GenerateConfig(conf.GithubConfigDir+"/default-user-quimby.yaml", &rdr, usrConf)
+	client, err := k8s.NewClient(conf.ClientOptions())
+	if err != nil {
+		return err
+	}
+	usrConf.Cluster, err = client.Cluster(ctx)
 	if err != nil {
 		return err
 	}
 
-	client, err := k8s.NewClient()
+	// Generate k8s user config from template
+	k8sUser, err := user.GenerateConfig(conf.TemplatePath(), rdr, usrConf)
 	if err != nil {
 		return err
 	}
-	client.Apply(username, k8sUser)
 
-	return nil
+	return cli.ApplyConflicts(func(force bool) error {
+		return client.Apply(ctx, username, k8sUser, force)
+	}, newForce, true)
 }
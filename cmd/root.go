@@ -5,9 +5,13 @@ Copyright © 2022 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
+	"github.com/uitml/quimby/internal/cli"
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -17,10 +21,16 @@ func newRootCmd() *cobra.Command {
 		Short: "User management tool for the Springfield k8s cluster",
 	}
 
+	cli.AddGlobalFlags(rootCmd.PersistentFlags())
+
 	rootCmd.AddCommand(newListCmd())
+	rootCmd.AddCommand(newShowCmd())
 	rootCmd.AddCommand(newCreateCmd())
 	rootCmd.AddCommand(newDeleteCmd())
 	rootCmd.AddCommand(newEditCmd())
+	rootCmd.AddCommand(newStorageCmd())
+	rootCmd.AddCommand(newConfigCmd())
+	rootCmd.AddCommand(newTemplateCmd())
 
 	return rootCmd
 }
@@ -28,20 +38,18 @@ func newRootCmd() *cobra.Command {
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	// Interrupts cancel the requests in flight. The signal handler is removed after the first
+	// interrupt, so that a second one exits right away, e.g. while waiting for a prompt.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
 	cmd := newRootCmd()
-	if err := cmd.Execute(); err != nil {
+	err := cmd.ExecuteContext(ctx)
+	stop()
+	if err != nil {
 		os.Exit(1)
 	}
 }
-
-func init() {
-	// Here you will define your flags and configuration settings.
-	// Cobra supports persistent flags, which, if defined here,
-	// will be global for your application.
-
-	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.quimby.yaml)")
-
-	// Cobra also supports local flags, which will only run
-	// when this action is called directly.
-	// rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
-}
@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/uitml/quimby/internal/cli"
+	"github.com/uitml/quimby/internal/k8s"
+	"github.com/uitml/quimby/internal/resource"
+	"github.com/uitml/quimby/internal/user"
+	"github.com/uitml/quimby/internal/validate"
+)
+
+var (
+	showValues   bool
+	showUsertype string
+)
+
+func newShowCmd() *cobra.Command {
+	var showCmd = &cobra.Command{
+		Use:   "show <username>",
+		Short: "Show the details of a Springfield user.",
+		Long: "Show the details of a Springfield user.\n\n" +
+			"With --values the effective values from the template source are shown instead, along\n" +
+			"with the values file that set each field. The usertype is read from the user, unless\n" +
+			"given with --usertype.",
+		Example: "  quimby show foo123\n  quimby show foo123 --values --usertype phd",
+		Args:    cobra.ExactArgs(1),
+
+		RunE: RunShow,
+	}
+
+	showCmd.Flags().BoolVar(&showValues, "values", false, "Show the merged values of the user and where each was set.")
+	showCmd.Flags().StringVar(&showUsertype, "usertype", "", "User type to merge the values for, instead of the type of the user.")
+
+	return showCmd
+}
+
+func RunShow(cmd *cobra.Command, args []string) error {
+	ctx, cancel := cli.Context(cmd)
+	defer cancel()
+
+	username := args[0]
+	if !validate.Username(username) {
+		return errors.Errorf("invalid username: %s", username)
+	}
+
+	conf, err := cli.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	client, err := k8s.NewClient(conf.ClientOptions())
+	if err != nil {
+		return err
+	}
+
+	exists, err := client.UserExists(ctx, username)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		// Values can be shown for users that do not exist yet
+		if showValues {
+			return showUserValues(ctx, conf, username, showUsertype)
+		}
+		return errors.Errorf("user %s does not exist", username)
+	}
+	ns, err := client.Namespace(ctx, username)
+	if err != nil {
+		return err
+	}
+	u := user.FromNamespace(*ns, conf.EmailDomain)
+	md := u.Metadata()
+
+	if showValues {
+		usertype := showUsertype
+		if usertype == "" {
+			usertype = md.Usertype
+		}
+		return showUserValues(ctx, conf, username, usertype)
+	}
+
+	spec, err := client.Spec(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{
+		{"fullname", md.Fullname},
+		{"email", md.Email},
+		{"usertype", md.Usertype},
+	}
+	for _, f := range resource.SpecFields {
+		rows = append(rows, []string{f.Key, f.Format(spec)})
+	}
+	for _, name := range resource.AcceleratorNames(spec) {
+		rows = append(rows, []string{resource.AcceleratorKey(name), fmt.Sprint(spec.Accelerators[name])})
+	}
+	rows = append(rows, []string{resource.GPUModelsKey, resource.FormatGPUModels(spec.GPUModels)})
+	cli.RenderTable([][]string{{"Field", "Value"}}, rows)
+
+	capacity, err := client.TotalGPUs(ctx)
+	if err != nil {
+		return err
+	}
+	if rows := hardwareRows(spec, capacity); len(rows) > 0 {
+		fmt.Println()
+		cli.RenderTable([][]string{{"Hardware", "Total", "Reachable"}}, rows)
+	}
+	if len(spec.GPUModels) > 0 {
+		fmt.Printf("\nAll pods of the user, including those without GPUs, are kept on nodes with %s by the\n"+
+			"node selector of the namespace.\n", resource.FormatGPUModels(spec.GPUModels))
+	}
+
+	return nil
+}
+
+// Returns a row for each GPU model of the cluster and each accelerator of spec, with whether the
+// jobs of spec can use them.
+func hardwareRows(spec *resource.Spec, capacity resource.Capacity) [][]string {
+	var models []string
+	for m := range capacity.GPUModels {
+		models = append(models, m)
+	}
+	sort.Strings(models)
+
+	var rows [][]string
+	for _, m := range models {
+		reachable := "no"
+		if spec.GPU != nil && *spec.GPU > 0 && spec.AllowsGPUModel(m) {
+			reachable = "yes"
+		}
+		name := m
+		if name == "" {
+			name = "unlabeled"
+		}
+		rows = append(rows, []string{name, fmt.Sprint(capacity.GPUModels[m]), reachable})
+	}
+	for _, name := range resource.AcceleratorNames(spec) {
+		reachable := "no"
+		if spec.Accelerators[name] > 0 {
+			reachable = "yes"
+		}
+		rows = append(rows, []string{string(name), fmt.Sprint(capacity.Resources[name].Max), reachable})
+	}
+
+	return rows
+}
+
+// Shows the values merged for a user from the template source, and the layer that set each.
+func showUserValues(ctx context.Context, conf *cli.App, username string, usertype string) error {
+	rdr, err := conf.Reader(ctx)
+	if err != nil {
+		return err
+	}
+	layers, err := user.ValueLayers(conf.ValuesPath(), usertype, username)
+	if err != nil {
+		return err
+	}
+
+	usr := user.Config{Username: username}
+	setBy, err := usr.PopulateLayers(layers, rdr)
+	if err != nil {
+		return err
+	}
+
+	cli.RenderTable([][]string{{"Field", "Value", "Set by"}}, valueRows(&usr, setBy))
+
+	return nil
+}
+
+// Returns the table rows of the values of usr, with the layer that set each field in setBy. The
+// fields of the spec are shown as unset if no layer set any of them.
+func valueRows(usr *user.Config, setBy map[string]string) [][]string {
+	source := func(key string) string {
+		if layer, ok := setBy[key]; ok {
+			return layer
+		}
+		return "-"
+	}
+	spec := usr.Spec
+	if spec == nil {
+		spec = &resource.Spec{}
+	}
+
+	var rows [][]string
+	if usr.Metadata != nil {
+		rows = append(rows,
+			[]string{"fullname", usr.Fullname, source("fullname")},
+			[]string{"email", usr.Email, source("email")},
+			[]string{"usertype", usr.Usertype, source("usertype")},
+		)
+	}
+	for _, f := range resource.SpecFields {
+		rows = append(rows, []string{f.Key, f.Format(spec), source(f.Key)})
+	}
+	for _, name := range resource.AcceleratorNames(spec) {
+		key := resource.AcceleratorKey(name)
+		rows = append(rows, []string{key, fmt.Sprint(spec.Accelerators[name]), source(key)})
+	}
+	rows = append(rows, []string{resource.GPUModelsKey, resource.FormatGPUModels(spec.GPUModels), source(resource.GPUModelsKey)})
+
+	return rows
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/openlyinc/pointy"
+	"github.com/uitml/quimby/internal/resource"
+	"github.com/uitml/quimby/internal/user"
+)
+
+func TestValueRows(t *testing.T) {
+	tests := []struct {
+		name  string
+		usr   user.Config
+		setBy map[string]string
+		want  map[string][]string // Value and set by, by field
+	}{
+		{
+			name:  "No resourcespec",
+			usr:   user.Config{Metadata: &user.Metadata{Usertype: "phd"}},
+			setBy: map[string]string{"usertype": "values/default-user.yaml"},
+			want: map[string][]string{
+				"usertype":            {"phd", "values/default-user.yaml"},
+				"gpu":                 {"<unset>", "-"},
+				resource.GPUModelsKey: {"<all>", "-"},
+			},
+		},
+		{
+			name:  "Resourcespec",
+			usr:   user.Config{Spec: &resource.Spec{GPU: pointy.Int64(2), GPUModels: []string{"NVIDIA-A100-SXM4-40GB"}}},
+			setBy: map[string]string{"gpu": "values/usertypes/phd.yaml", resource.GPUModelsKey: "values/default-user.yaml"},
+			want: map[string][]string{
+				"gpu":                 {"2 GPUs", "values/usertypes/phd.yaml"},
+				resource.GPUModelsKey: {"NVIDIA-A100-SXM4-40GB", "values/default-user.yaml"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := make(map[string][]string)
+			for _, r := range valueRows(&tt.usr, tt.setBy) {
+				rows[r[0]] = r[1:]
+			}
+			if len(rows) == 0 {
+				t.Fatal("valueRows() returned no rows")
+			}
+			for field, want := range tt.want {
+				if got := rows[field]; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+					t.Errorf("valueRows() %s = %v, want %v", field, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/uitml/quimby/internal/cli"
+	"github.com/uitml/quimby/internal/k8s"
+	"github.com/uitml/quimby/internal/resource"
+	"github.com/uitml/quimby/internal/validate"
+)
+
+var (
+	resizeTimeout time.Duration
+	resizeYes     bool
+)
+
+func newStorageCmd() *cobra.Command {
+	var storageCmd = &cobra.Command{
+		Use:   "storage",
+		Short: "Manage the storage of a user.",
+
+		RunE: func(*cobra.Command, []string) error { return fmt.Errorf("missing subcommand") },
+	}
+
+	var resizeCmd = &cobra.Command{
+		Use:   "resize <username> <size>",
+		Short: "Expand the storage volume of a user.",
+		Long: "Expand the storage volume of a user.\n\n" +
+			"The size is given in GiB or as a quantity, e.g. 1Ti. Volumes can only be expanded,\n" +
+			"and only if their storage class allows volume expansion.",
+		Args: cobra.ExactArgs(2),
+
+		RunE: RunResize,
+	}
+	resizeCmd.Flags().DurationVar(&resizeTimeout, "wait-timeout", 5*time.Minute, "How long to wait for the resize to finish.")
+	resizeCmd.Flags().BoolVarP(&resizeYes, "yes", "y", false, "Resize without asking for confirmation.")
+
+	storageCmd.AddCommand(resizeCmd)
+
+	return storageCmd
+}
+
+func RunResize(cmd *cobra.Command, args []string) error {
+	ctx, cancel := cli.Context(cmd)
+	defer cancel()
+
+	username := args[0]
+	if !validate.Username(username) {
+		return errors.Errorf("invalid username: %s", username)
+	}
+
+	size, err := resource.UnitGiB.Parse(args[1])
+	if err != nil {
+		return err
+	}
+
+	conf, err := cli.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	client, err := k8s.NewClient(conf.ClientOptions())
+	if err != nil {
+		return err
+	}
+
+	if !resizeYes {
+		c, err := cli.Confirmation(fmt.Sprintf("Expand the storage of user %s to %d GiB? Volumes can not be shrunk again.", username, size), false)
+		if err != nil {
+			return err
+		}
+		if !c {
+			fmt.Printf("Storage of user %s not resized.\n", username)
+			return nil
+		}
+	}
+
+	err = client.ResizeStorage(ctx, username, *resource.UnitGiB.Quantity(size), resizeTimeout)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Storage of user %s resized to %d GiB.\n", username, size)
+
+	return nil
+}
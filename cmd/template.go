@@ -0,0 +1,395 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/uitml/quimby/internal/cli"
+	"github.com/uitml/quimby/internal/k8s"
+	"github.com/uitml/quimby/internal/templates"
+	"github.com/uitml/quimby/internal/user"
+	"github.com/uitml/quimby/internal/user/reader"
+)
+
+// The size limit of the data in a ConfigMap
+const maxConfigMapSize = 1 << 20
+
+var (
+	publishYes     bool
+	publishForce   bool
+	dumpForce      bool
+	lintValues     string
+	templateUpdate bool
+)
+
+func newTemplateCmd() *cobra.Command {
+	var templateCmd = &cobra.Command{
+		Use:   "template",
+		Short: "Manage the user templates.",
+
+		RunE: func(*cobra.Command, []string) error { return fmt.Errorf("missing subcommand") },
+	}
+
+	var publishCmd = &cobra.Command{
+		Use:   "publish <dir>",
+		Short: "Upload a template directory into the template ConfigMap of the cluster.",
+		Long: "Upload a template directory into the template ConfigMap of the cluster.\n\n" +
+			"Every file below the directory is stored under its path, with '/' replaced by '.',\n" +
+			"e.g. values/default-user.yaml is stored as values.default-user.yaml. Hidden files are\n" +
+			"skipped. The ConfigMap is given by sourcepath when source is configmap, and is\n" +
+			cli.DefaultTemplateConfigMap + " otherwise.",
+		Example: "  quimby template publish ./springfield-templates",
+		Args:    cobra.ExactArgs(1),
+
+		RunE: RunTemplatePublish,
+	}
+	publishCmd.Flags().BoolVarP(&publishYes, "yes", "y", false, "Publish without asking for confirmation.")
+	publishCmd.Flags().BoolVar(&publishForce, "force-conflicts", false, "Take over fields owned by other field managers, e.g. changed with kubectl, without asking.")
+
+	var dumpCmd = &cobra.Command{
+		Use:   "dump [dir]",
+		Short: "Write the built-in templates to a directory.",
+		Long: "Write the built-in templates to a directory, the current directory by default.\n\n" +
+			"The built-in templates are used when no template source is configured, and are a\n" +
+			"starting point for a template repo. When used as a template source, set githubconfigdir\n" +
+			"to config and githubvaluedir to values.",
+		Example: "  quimby template dump ./springfield-templates",
+		Args:    cobra.MaximumNArgs(1),
+
+		RunE: RunTemplateDump,
+	}
+	dumpCmd.Flags().BoolVarP(&dumpForce, "force", "f", false, "Overwrite existing files.")
+
+	var lintCmd = &cobra.Command{
+		Use:   "lint",
+		Short: "Check that the quimby template renders valid objects.",
+		Long: "Check that the quimby template renders valid objects.\n\n" +
+			"The template is rendered with the default values, and with edge cases derived from\n" +
+			"them, such as no GPUs and huge storage. Every object must be a valid object of a\n" +
+			"supported kind, or of a kind in allowedkinds, in the user namespace, and the objects\n" +
+			"quimby reads back must exist.",
+		Example: "  quimby template lint\n  quimby template lint --values ./values/default-user.yaml",
+		Args:    cobra.NoArgs,
+
+		RunE: RunTemplateLint,
+	}
+	lintCmd.Flags().StringVar(&lintValues, "values", "", "Local values file to render with, instead of the default values of the template source.")
+
+	var testCmd = &cobra.Command{
+		Use:   "test",
+		Short: "Compare the renders of the quimby template with their golden files.",
+		Long: "Compare the renders of the quimby template with their golden files.\n\n" +
+			"The template is rendered with the same cases as template lint, and each render is\n" +
+			"compared to testdata/<case>.golden.yaml next to the template. With --update the golden\n" +
+			"files are written instead, which requires source dir.",
+		Args: cobra.NoArgs,
+
+		RunE: RunTemplateTest,
+	}
+	testCmd.Flags().BoolVar(&templateUpdate, "update", false, "Write the renders to the golden files.")
+
+	templateCmd.AddCommand(publishCmd)
+	templateCmd.AddCommand(dumpCmd)
+	templateCmd.AddCommand(lintCmd)
+	templateCmd.AddCommand(testCmd)
+
+	return templateCmd
+}
+
+func RunTemplatePublish(cmd *cobra.Command, args []string) error {
+	ctx, cancel := cli.Context(cmd)
+	defer cancel()
+
+	conf, err := cli.LoadConfig()
+	if err != nil {
+		return err
+	}
+	namespace, name, err := conf.TemplateConfigMap()
+	if err != nil {
+		return err
+	}
+
+	data, err := templateData(args[0])
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return errors.Errorf("no files found in %s", args[0])
+	}
+
+	var keys []string
+	size := 0
+	for key, value := range data {
+		keys = append(keys, key)
+		size += len(key) + len(value)
+	}
+	if size > maxConfigMapSize {
+		return errors.Errorf("templates are %s, which is more than the %s a ConfigMap can hold",
+			humanize.IBytes(uint64(size)), humanize.IBytes(maxConfigMapSize))
+	}
+	sort.Strings(keys)
+
+	var rows [][]string
+	for _, key := range keys {
+		rows = append(rows, []string{key, humanize.IBytes(uint64(len(data[key])))})
+	}
+	cli.RenderTable([][]string{{"Key", "Size"}}, rows)
+
+	if !publishYes {
+		c, err := cli.Confirmation(fmt.Sprintf("Replace the contents of ConfigMap %s/%s with these files?", namespace, name), false)
+		if err != nil {
+			return err
+		}
+		if !c {
+			fmt.Println("Templates not published.")
+			return nil
+		}
+	}
+
+	client, err := k8s.NewClient(conf.ClientOptions())
+	if err != nil {
+		return err
+	}
+	err = cli.ApplyConflicts(func(force bool) error {
+		return client.ApplyConfigMap(ctx, namespace, name, data, force)
+	}, publishForce, !publishYes)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Published %d files to ConfigMap %s/%s.\n", len(keys), namespace, name)
+
+	return nil
+}
+
+func RunTemplateDump(cmd *cobra.Command, args []string) error {
+	dir := "."
+	if len(args) == 1 {
+		dir = args[0]
+	}
+
+	files, err := templates.Files()
+	if err != nil {
+		return err
+	}
+	if !dumpForce {
+		for _, p := range files {
+			path := filepath.Join(dir, filepath.FromSlash(p))
+			if _, err := os.Stat(path); err == nil {
+				return errors.Errorf("%s already exists, use --force to overwrite it", path)
+			}
+		}
+	}
+
+	for _, p := range files {
+		b, err := fs.ReadFile(templates.FS, p)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, b, 0644); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %s\n", path)
+	}
+
+	return nil
+}
+
+func RunTemplateLint(cmd *cobra.Command, args []string) error {
+	ctx, cancel := cli.Context(cmd)
+	defer cancel()
+
+	conf, err := cli.LoadConfig()
+	if err != nil {
+		return err
+	}
+	rdr, err := conf.Reader(ctx)
+	if err != nil {
+		return err
+	}
+
+	allowed, err := conf.AllowedGroupVersionKinds()
+	if err != nil {
+		return err
+	}
+	values := user.Config{}
+	if lintValues != "" {
+		err = values.Populate(lintValues, &reader.File{})
+	} else {
+		err = values.Populate(conf.ValuesPath(), rdr)
+	}
+	if err != nil {
+		return err
+	}
+
+	var rows [][]string
+	failed := 0
+	cases := user.LintCases(values)
+	for _, c := range cases {
+		result := "ok"
+		if _, err := user.Lint(conf.TemplatePath(), rdr, c.Config, allowed); err != nil {
+			result = "failed: " + err.Error()
+			failed++
+		}
+		rows = append(rows, []string{c.Name, result})
+	}
+	cli.RenderTable([][]string{{"Case", "Result"}}, rows)
+
+	if failed > 0 {
+		return errors.Errorf("%d of %d cases failed", failed, len(cases))
+	}
+
+	return nil
+}
+
+func RunTemplateTest(cmd *cobra.Command, args []string) error {
+	ctx, cancel := cli.Context(cmd)
+	defer cancel()
+
+	conf, err := cli.LoadConfig()
+	if err != nil {
+		return err
+	}
+	if templateUpdate && conf.Source != "dir" {
+		return errors.New("--update requires source dir, golden files can only be written to a local directory")
+	}
+	rdr, err := conf.Reader(ctx)
+	if err != nil {
+		return err
+	}
+
+	values := user.Config{}
+	if err := values.Populate(conf.ValuesPath(), rdr); err != nil {
+		return err
+	}
+
+	var rows [][]string
+	failed := 0
+	cases := user.LintCases(values)
+	for _, c := range cases {
+		golden := user.GoldenPath(conf.TemplatePath(), c.Name)
+		result, err := testCase(conf, rdr, c, golden)
+		if err != nil {
+			result = "failed: " + err.Error()
+			failed++
+		}
+		rows = append(rows, []string{c.Name, golden, result})
+	}
+	cli.RenderTable([][]string{{"Case", "Golden file", "Result"}}, rows)
+
+	if failed > 0 {
+		return errors.Errorf("%d of %d cases failed", failed, len(cases))
+	}
+
+	return nil
+}
+
+// Renders a lint case and compares it to its golden file, or updates the golden file with
+// --update. Returns the result to show for the case.
+func testCase(conf *cli.App, rdr reader.Config, c user.LintCase, golden string) (string, error) {
+	allowed, err := conf.AllowedGroupVersionKinds()
+	if err != nil {
+		return "", err
+	}
+	got, err := user.Lint(conf.TemplatePath(), rdr, c.Config, allowed)
+	if err != nil {
+		return "", err
+	}
+
+	if templateUpdate {
+		path := filepath.Join(conf.SourcePath, filepath.FromSlash(golden))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			return "", err
+		}
+		return "updated", nil
+	}
+
+	want, err := rdr.Read(golden)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", errors.New("missing golden file, run template test --update to create it")
+	}
+	if err != nil {
+		return "", err
+	}
+	if line, w, g, ok := firstDiff(want, got); ok {
+		return "", errors.Errorf("line %d: want %q, got %q", line, w, g)
+	}
+
+	return "ok", nil
+}
+
+// Returns the first line that differs between want and got, and its line number.
+func firstDiff(want []byte, got []byte) (int, string, string, bool) {
+	wantLines := strings.Split(string(want), "\n")
+	gotLines := strings.Split(string(got), "\n")
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g || i >= len(wantLines) || i >= len(gotLines) {
+			return i + 1, w, g, true
+		}
+	}
+
+	return 0, "", "", false
+}
+
+// Returns the files below dir, keyed by their ConfigMap key. Hidden files and directories are
+// skipped.
+func templateData(dir string) (map[string]string, error) {
+	data := make(map[string]string)
+	paths := make(map[string]string)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		key := reader.ConfigMapKey(rel)
+		if other, ok := paths[key]; ok {
+			return errors.Errorf("%s and %s would both be stored as %s", other, rel, key)
+		}
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		data[key], paths[key] = string(b), rel
+
+		return nil
+	})
+
+	return data, err
+}
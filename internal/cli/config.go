@@ -1,6 +1,25 @@
 package cli
 
-import "github.com/spf13/viper"
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/uitml/quimby/internal/k8s"
+	"github.com/uitml/quimby/internal/resource"
+	"github.com/uitml/quimby/internal/templates"
+	"github.com/uitml/quimby/internal/user/reader"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// DefaultTemplateConfigMap is the namespace/name of the ConfigMap holding the templates, unless
+// configured otherwise.
+const DefaultTemplateConfigMap = "quimby-system/quimby-templates"
 
 type App struct {
 	GithubUser      string
@@ -8,16 +27,96 @@ type App struct {
 	GithubRepo      string
 	GithubConfigDir string
 	GithubValueDir  string
+	GithubURL       string // API base URL, for GitHub Enterprise
+	GithubRef       string // Branch, tag or commit to read templates from
+
+	// Where templates are read from: github, dir, git, configmap or embedded. For dir, SourcePath
+	// is the directory to read from. For git, it is a local clone, read at SourceRef. For
+	// configmap, it is the namespace/name of the ConfigMap in the cluster. Defaults to github if
+	// GithubRepo is set, and to the templates embedded in the binary otherwise.
+	Source     string
+	SourcePath string
+	SourceRef  string
+
+	// Kubeconfig context of the cluster, and the domain of generated e-mail addresses
+	Context     string
+	EmailDomain string
+
+	// Client side rate limit of requests to the cluster, the defaults of client-go if 0
+	QPS   float32
+	Burst int
+
+	// Extended resources of accelerators besides nvidia.com/gpu, e.g. MIG slices such as
+	// nvidia.com/mig-1g.10gb. Each is listed and given a quota separately.
+	Accelerators []string
+
+	// Kinds the user template may create besides the built-in ones, as apiVersion/Kind, e.g.
+	// networking.k8s.io/v1/NetworkPolicy. Each must be namespaced.
+	AllowedKinds []string
+
+	// Resource spec fields locked for each admin group, a group of users on the cluster. Fields
+	// locked for every admin group of the current user can not be changed.
+	LockedFields map[string][]string
+
+	// Groups of the current user as authenticated by the cluster, set from k8s.Client.Groups by
+	// the commands that check LockedFields
+	Groups []string `mapstructure:"-" yaml:"-"`
+
+	// Named profiles, each overriding the settings above for one cluster
+	CurrentProfile string             `mapstructure:"current-profile" yaml:"current-profile,omitempty"`
+	Profiles       map[string]Profile `yaml:",omitempty"`
+
+	// Name of the profile in use, if any, and the config before it was applied
+	Profile string `mapstructure:"-" yaml:"-"`
+	base    *App
+}
+
+// Profile bundles the settings that differ between clusters. Empty values are inherited from
+// the top level of the config.
+type Profile struct {
+	Context         string
+	GithubConfigDir string
+	GithubValueDir  string
+	EmailDomain     string
+	Accelerators    []string
+	AllowedKinds    []string
+}
+
+// Returns the path of the config file, given the path from the command line.
+func configPath(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".config", "quimby", "config.yaml"), nil
 }
 
-func ParseConfig() (*App, error) {
+// Parses the config file at path, or $HOME/.config/quimby/config.yaml if path is empty, and
+// applies the named profile. If profile is empty, the current profile of the config is used.
+// Values can be overridden by QUIMBY_* environment variables.
+func ParseConfig(path string, profile string) (*App, error) {
 	v := viper.New()
-	v.AddConfigPath("$HOME/.config/quimby")
-	v.SetConfigName("config")
+	if path != "" {
+		v.SetConfigFile(path)
+	} else {
+		v.AddConfigPath("$HOME/.config/quimby")
+		v.SetConfigName("config")
+	}
 	v.SetConfigType("yaml")
 
+	// Unmarshal only sees the environment variables of bound keys, e.g. QUIMBY_CURRENT_PROFILE
 	v.SetEnvPrefix("quimby")
-	v.AutomaticEnv()
+	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	for _, key := range configKeys {
+		if err := v.BindEnv(key); err != nil {
+			return nil, err
+		}
+	}
 
 	cfg := &App{}
 	if err := v.ReadInConfig(); err != nil {
@@ -30,5 +129,353 @@ func ParseConfig() (*App, error) {
 		return nil, err
 	}
 
-	return cfg, nil
+	if profile == "" {
+		profile = cfg.CurrentProfile
+	}
+	if profile == "" {
+		return cfg, nil
+	}
+
+	return cfg.WithProfile(profile)
+}
+
+// LoadConfig parses the config given by the global flags.
+func LoadConfig() (*App, error) {
+	return ParseConfig(Global.ConfigFile, Global.Profile)
+}
+
+// WithProfile returns a copy of the config with the named profile applied.
+func (a *App) WithProfile(name string) (*App, error) {
+	base := a
+	if a.base != nil {
+		base = a.base
+	}
+
+	p, ok := base.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %s does not exist", name)
+	}
+
+	cfg := *base
+	cfg.Profile = name
+	cfg.base = base
+	if p.Context != "" {
+		cfg.Context = p.Context
+	}
+	if p.GithubConfigDir != "" {
+		cfg.GithubConfigDir = p.GithubConfigDir
+	}
+	if p.GithubValueDir != "" {
+		cfg.GithubValueDir = p.GithubValueDir
+	}
+	if p.EmailDomain != "" {
+		cfg.EmailDomain = p.EmailDomain
+	}
+	if len(p.Accelerators) > 0 {
+		cfg.Accelerators = p.Accelerators
+	}
+	if len(p.AllowedKinds) > 0 {
+		cfg.AllowedKinds = p.AllowedKinds
+	}
+
+	return &cfg, nil
+}
+
+// ProfileNames returns the names of all profiles, sorted.
+func (a *App) ProfileNames() []string {
+	var names []string
+	for name := range a.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// ClientOptions returns the options for connecting to the cluster of the config. The global
+// flags take precedence over the config.
+func (a *App) ClientOptions() k8s.ClientOptions {
+	opts := flagClientOptions()
+	if opts.Context == "" {
+		opts.Context = a.Context
+	}
+	if opts.QPS == 0 {
+		opts.QPS = a.QPS
+	}
+	if opts.Burst == 0 {
+		opts.Burst = a.Burst
+	}
+	opts.Accelerators = a.AcceleratorResources()
+	opts.AllowedKinds, _ = a.AllowedGroupVersionKinds()
+
+	return opts
+}
+
+// AcceleratorResources returns the resource names of the accelerators of the config.
+func (a *App) AcceleratorResources() []corev1.ResourceName {
+	var names []corev1.ResourceName
+	for _, name := range a.Accelerators {
+		names = append(names, corev1.ResourceName(name))
+	}
+
+	return names
+}
+
+// ValidateAccelerators returns an error if any of the accelerators of the config is not an
+// extended resource name.
+func (a *App) ValidateAccelerators() error {
+	for _, name := range a.AcceleratorResources() {
+		if name == resource.ResourceGPU {
+			return fmt.Errorf("accelerators: %s is given by the gpu fields, and must not be listed", name)
+		}
+		if err := resource.ValidateAccelerator(name); err != nil {
+			return fmt.Errorf("accelerators: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// AllowedGroupVersionKinds returns the allowed kinds of the config. Returns the kinds that are
+// valid along with an error for the first that is not.
+func (a *App) AllowedGroupVersionKinds() ([]schema.GroupVersionKind, error) {
+	var kinds []schema.GroupVersionKind
+	var err error
+	for _, s := range a.AllowedKinds {
+		gvk, kerr := k8s.ParseKind(s)
+		if kerr != nil {
+			if err == nil {
+				err = fmt.Errorf("allowedkinds: %w", kerr)
+			}
+			continue
+		}
+		kinds = append(kinds, gvk)
+	}
+
+	return kinds, err
+}
+
+// Keys of the settings in the config, and in each profile.
+var (
+	configKeys = []string{
+		"githubuser", "githubtoken", "githubrepo", "githubconfigdir", "githubvaluedir",
+		"githuburl", "githubref", "source", "sourcepath", "sourceref",
+		"context", "emaildomain", "qps", "burst", "accelerators", "allowedkinds",
+		"current-profile",
+	}
+	profileKeys = []string{"context", "githubconfigdir", "githubvaluedir", "emaildomain", "accelerators", "allowedkinds"}
+)
+
+// ValidKey returns true if key names a setting that can be set with SetConfigValues, either at
+// the top level or in a profile, e.g. profiles.staging.context.
+func ValidKey(key string) bool {
+	keys := configKeys
+	parts := strings.Split(strings.ToLower(key), ".")
+	if len(parts) == 3 && parts[0] == "profiles" && parts[1] != "" {
+		keys, parts = profileKeys, parts[2:]
+	}
+	if len(parts) != 1 {
+		return false
+	}
+
+	for _, k := range keys {
+		if k == parts[0] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ConfigFile returns the path of the config file given by the global flags.
+func ConfigFile() (string, error) {
+	return configPath(Global.ConfigFile)
+}
+
+// Redacted returns a copy of the config with secrets hidden, suitable for display.
+func (a *App) Redacted() *App {
+	cfg := *a
+	if cfg.GithubToken != "" {
+		cfg.GithubToken = "REDACTED"
+	}
+
+	return &cfg
+}
+
+// SetConfigValues sets the given keys in the config file at path, or the default config file if
+// path is empty, keeping the other keys. The file is created if it does not exist, and is only
+// readable by the owner. A failed write leaves the file as it was.
+func SetConfigValues(path string, values map[string]interface{}) error {
+	path, err := configPath(path)
+	if err != nil {
+		return err
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for key, value := range values {
+		v.Set(key, value)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	// Written to a temporary file that replaces the config once complete. The config may hold the
+	// GitHub token, so only the owner may read it, also if the file existed with wider permissions.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".config-*.yaml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	v.SetConfigPermissions(0600)
+	if err := v.WriteConfigAs(tmp.Name()); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Reader returns the reader for the template source of the config, reading from the cluster or
+// GitHub until ctx is done. Files read from GitHub are cached, unless disabled with --no-cache.
+func (a *App) Reader(ctx context.Context) (reader.Config, error) {
+	rdr, err := a.UncachedReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	gh, ok := rdr.(*reader.Github)
+	if !ok || Global.NoCache {
+		return rdr, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return rdr, nil
+	}
+
+	return &reader.Cached{
+		Reader: gh,
+		Dir:    filepath.Join(dir, "quimby"),
+		Key:    gh.BaseURL + "/" + gh.Repo + "@" + gh.Ref,
+	}, nil
+}
+
+// UncachedReader returns the reader for the template source of the config, without any cache.
+func (a *App) UncachedReader(ctx context.Context) (reader.Config, error) {
+	if a.embedded() {
+		return &reader.FS{FS: templates.FS}, nil
+	}
+
+	switch a.Source {
+	case "", "github":
+		if a.GithubRepo == "" {
+			return nil, fmt.Errorf("source github requires githubrepo to be set")
+		}
+		return &reader.Github{
+			Username: a.GithubUser,
+			Token:    a.GithubToken,
+			Repo:     a.GithubRepo,
+			BaseURL:  a.GithubURL,
+			Ref:      a.GithubRef,
+			Context:  ctx,
+		}, nil
+	case "dir":
+		if a.SourcePath == "" {
+			return nil, fmt.Errorf("source dir requires sourcepath to be set")
+		}
+		return &reader.Dir{Root: a.SourcePath}, nil
+	case "git":
+		if a.SourcePath == "" {
+			return nil, fmt.Errorf("source git requires sourcepath to be set")
+		}
+		return &reader.Git{Repo: a.SourcePath, Ref: a.SourceRef}, nil
+	case "configmap":
+		namespace, name, err := a.TemplateConfigMap()
+		if err != nil {
+			return nil, err
+		}
+		client, err := k8s.NewClient(a.ClientOptions())
+		if err != nil {
+			return nil, err
+		}
+		return &reader.ConfigMap{Client: client, Namespace: namespace, Name: name, Context: ctx}, nil
+	}
+
+	return nil, fmt.Errorf("unknown template source: %s", a.Source)
+}
+
+// TemplateConfigMap returns the namespace and name of the ConfigMap templates are read from with
+// source configmap, and published to by template publish.
+func (a *App) TemplateConfigMap() (string, string, error) {
+	ref := DefaultTemplateConfigMap
+	if a.Source == "configmap" && a.SourcePath != "" {
+		ref = a.SourcePath
+	}
+	parts := strings.Split(ref, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid configmap %q, want namespace/name", ref)
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// Returns true if the templates embedded in the binary are used.
+func (a *App) embedded() bool {
+	return a.Source == "embedded" || (a.Source == "" && a.GithubRepo == "")
+}
+
+// TemplatePath returns the path of the quimby template within the template source.
+func (a *App) TemplatePath() string {
+	if a.embedded() {
+		return templates.TemplatePath
+	}
+	return a.GithubConfigDir + "/default-user-quimby.yaml"
+}
+
+// ValuesPath returns the path of the default values within the template source.
+func (a *App) ValuesPath() string {
+	if a.embedded() {
+		return templates.ValuesPath
+	}
+	return a.GithubValueDir + "/default-user.yaml"
+}
+
+// AdminGroups returns the groups of the current user that have LockedFields, sorted.
+func (a *App) AdminGroups() []string {
+	var groups []string
+	for _, g := range a.Groups {
+		if _, ok := a.LockedFields[g]; ok {
+			groups = append(groups, g)
+		}
+	}
+	sort.Strings(groups)
+
+	return groups
+}
+
+// Locked returns true if the resource spec field with the given key is locked for every admin
+// group of the current user, so that the group with the fewest locks applies. Nothing is locked
+// for users in none of the admin groups.
+func (a *App) Locked(key string) bool {
+	groups := a.AdminGroups()
+	for _, g := range groups {
+		locked := false
+		for _, k := range a.LockedFields[g] {
+			locked = locked || k == key
+		}
+		if !locked {
+			return false
+		}
+	}
+
+	return len(groups) > 0
 }
@@ -0,0 +1,444 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/uitml/quimby/internal/templates"
+	"github.com/uitml/quimby/internal/user/reader"
+)
+
+func TestApp_Locked(t *testing.T) {
+	lockedFields := map[string][]string{
+		"staff":  {"storagesize", "gpu"},
+		"phd":    {"gpu"},
+		"admins": {},
+	}
+
+	type args struct {
+		groups []string
+		key    string
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "Locked for group",
+			args: args{groups: []string{"system:authenticated", "staff"}, key: "gpu"},
+			want: true,
+		},
+		{
+			name: "Not locked for group",
+			args: args{groups: []string{"staff"}, key: "cpuperjob"},
+			want: false,
+		},
+		{
+			name: "Locked for every group",
+			args: args{groups: []string{"staff", "phd"}, key: "gpu"},
+			want: true,
+		},
+		{
+			name: "Not locked for one of the groups",
+			args: args{groups: []string{"staff", "phd"}, key: "storagesize"},
+			want: false,
+		},
+		{
+			name: "Nothing locked for group",
+			args: args{groups: []string{"staff", "admins"}, key: "gpu"},
+			want: false,
+		},
+		{
+			name: "No admin group",
+			args: args{groups: []string{"system:authenticated"}, key: "gpu"},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &App{Groups: tt.args.groups, LockedFields: lockedFields}
+			if got := a.Locked(tt.args.key); got != tt.want {
+				t.Errorf("App.Locked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	config := `githubrepo: uitml/springfield
+githubconfigdir: config
+context: springfield
+current-profile: production
+profiles:
+  production:
+    githubconfigdir: production
+  staging:
+    context: springfield-staging
+    emaildomain: uit.no
+`
+	err := os.WriteFile(path, []byte(config), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type want struct {
+		profile         string
+		context         string
+		githubConfigDir string
+		emailDomain     string
+	}
+	tests := []struct {
+		name    string
+		path    string
+		profile string
+		want    want
+		wantErr bool
+	}{
+		{
+			name: "Current profile",
+			path: path,
+			want: want{profile: "production", context: "springfield", githubConfigDir: "production"},
+		},
+		{
+			name:    "Explicit profile",
+			path:    path,
+			profile: "staging",
+			want:    want{profile: "staging", context: "springfield-staging", githubConfigDir: "config", emailDomain: "uit.no"},
+		},
+		{
+			name:    "Profile does not exist",
+			path:    path,
+			profile: "foo",
+			wantErr: true,
+		},
+		{
+			name:    "Explicit config file does not exist",
+			path:    filepath.Join(dir, "missing.yaml"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseConfig(tt.path, tt.profile)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseConfig() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if got.GithubRepo != "uitml/springfield" {
+				t.Errorf("ParseConfig() GithubRepo = %v, want %v", got.GithubRepo, "uitml/springfield")
+			}
+			g := want{profile: got.Profile, context: got.Context, githubConfigDir: got.GithubConfigDir, emailDomain: got.EmailDomain}
+			if g != tt.want {
+				t.Errorf("ParseConfig() = %+v, want %+v", g, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseConfig_env(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("githubrepo: a/b\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Keys missing from the file
+	t.Setenv("QUIMBY_GITHUBTOKEN", "secret")
+	t.Setenv("QUIMBY_SOURCE", "embedded")
+	t.Setenv("QUIMBY_ACCELERATORS", "nvidia.com/mig-1g.5gb,nvidia.com/mig-2g.10gb")
+
+	got, err := ParseConfig(path, "")
+	if err != nil {
+		t.Fatalf("ParseConfig() error = %v", err)
+	}
+	if got.GithubRepo != "a/b" || got.GithubToken != "secret" || got.Source != "embedded" {
+		t.Errorf("ParseConfig() = %q, %q, %q, want a/b, secret, embedded", got.GithubRepo, got.GithubToken, got.Source)
+	}
+	if want := []string{"nvidia.com/mig-1g.5gb", "nvidia.com/mig-2g.10gb"}; !reflect.DeepEqual(got.Accelerators, want) {
+		t.Errorf("ParseConfig() Accelerators = %v, want %v", got.Accelerators, want)
+	}
+}
+
+func TestApp_WithProfile(t *testing.T) {
+	base := &App{
+		GithubValueDir: "values",
+		Profiles: map[string]Profile{
+			"production": {GithubValueDir: "production"},
+			"staging":    {Context: "staging"},
+		},
+	}
+
+	production, err := base.WithProfile("production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Switching profile starts from the base config, not the current profile
+	staging, err := production.WithProfile("staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if production.GithubValueDir != "production" {
+		t.Errorf("App.WithProfile() GithubValueDir = %v, want %v", production.GithubValueDir, "production")
+	}
+	if staging.GithubValueDir != "values" || staging.Context != "staging" {
+		t.Errorf("App.WithProfile() = %+v, want GithubValueDir values and Context staging", staging)
+	}
+}
+
+func TestApp_ValidateAccelerators(t *testing.T) {
+	tests := []struct {
+		name         string
+		accelerators []string
+		wantErr      bool
+	}{
+		{name: "None", accelerators: nil},
+		{name: "MIG slices", accelerators: []string{"nvidia.com/mig-1g.10gb", "nvidia.com/mig-3g.40gb"}},
+		{name: "GPUs are given by the gpu fields", accelerators: []string{"nvidia.com/gpu"}, wantErr: true},
+		{name: "Not an extended resource", accelerators: []string{"cpu"}, wantErr: true},
+		{name: "Invalid name", accelerators: []string{"nvidia.com/mig 1g"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &App{Accelerators: tt.accelerators}
+			if err := a.ValidateAccelerators(); (err != nil) != tt.wantErr {
+				t.Errorf("App.ValidateAccelerators() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApp_AllowedGroupVersionKinds(t *testing.T) {
+	a := &App{AllowedKinds: []string{"networking.k8s.io/v1/NetworkPolicy", "NetworkPolicy", "v1/ConfigMap"}}
+
+	got, err := a.AllowedGroupVersionKinds()
+	if err == nil {
+		t.Errorf("App.AllowedGroupVersionKinds() error = nil, want an error for NetworkPolicy")
+	}
+	if len(got) != 2 || got[0].Group != "networking.k8s.io" || got[1].Kind != "ConfigMap" {
+		t.Errorf("App.AllowedGroupVersionKinds() = %v, want the two valid kinds", got)
+	}
+}
+
+func TestValidKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{key: "githubrepo", want: true},
+		{key: "GithubRepo", want: true},
+		{key: "current-profile", want: true},
+		{key: "profiles.staging.context", want: true},
+		{key: "profiles.staging.accelerators", want: true},
+		{key: "qps", want: true},
+		{key: "profiles.staging.allowedkinds", want: true},
+		{key: "profiles.staging.burst", want: false},
+		{key: "profiles.staging.githubtoken", want: false},
+		{key: "profiles..context", want: false},
+		{key: "profiles.staging", want: false},
+		{key: "foo", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := ValidKey(tt.key); got != tt.want {
+				t.Errorf("ValidKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApp_ClientOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		qps       float32
+		burst     int
+		wantQPS   float32
+		wantBurst int
+	}{
+		{name: "Config", wantQPS: 20, wantBurst: 40},
+		{name: "Flags override the config", qps: 50, burst: 100, wantQPS: 50, wantBurst: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Global.QPS, Global.Burst = tt.qps, tt.burst
+			defer func() { Global.QPS, Global.Burst = 0, 0 }()
+
+			a := &App{QPS: 20, Burst: 40}
+			got := a.ClientOptions()
+			if got.QPS != tt.wantQPS || got.Burst != tt.wantBurst {
+				t.Errorf("App.ClientOptions() qps, burst = %v, %v, want %v, %v", got.QPS, got.Burst, tt.wantQPS, tt.wantBurst)
+			}
+		})
+	}
+}
+
+func TestApp_Redacted(t *testing.T) {
+	a := &App{GithubUser: "foo", GithubToken: "secret"}
+
+	got := a.Redacted()
+	if got.GithubToken != "REDACTED" || got.GithubUser != "foo" {
+		t.Errorf("App.Redacted() = %+v, want the token redacted", got)
+	}
+	if a.GithubToken != "secret" {
+		t.Errorf("App.Redacted() modified the original config")
+	}
+}
+
+func TestSetConfigValues(t *testing.T) {
+	dir := t.TempDir()
+	created := filepath.Join(dir, "new", "config.yaml")
+	existing := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(existing, []byte("githubrepo: uitml/springfield\nprofiles:\n  staging:\n    context: springfield-staging\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{created, existing} {
+		if err := SetConfigValues(path, map[string]interface{}{"githubtoken": "secret"}); err != nil {
+			t.Fatalf("SetConfigValues(%s) error = %v", path, err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("SetConfigValues(%s) permissions = %o, want 600", path, perm)
+		}
+		conf, err := ParseConfig(path, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conf.GithubToken != "secret" {
+			t.Errorf("SetConfigValues(%s) githubtoken = %q, want secret", path, conf.GithubToken)
+		}
+		files, err := os.ReadDir(filepath.Dir(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range files {
+			if f.Name() != "config.yaml" && !f.IsDir() {
+				t.Errorf("SetConfigValues(%s) left %s behind", path, f.Name())
+			}
+		}
+	}
+
+	conf, err := ParseConfig(existing, "staging")
+	if err != nil {
+		t.Fatalf("SetConfigValues() lost the profiles: %v", err)
+	}
+	if conf.GithubRepo != "uitml/springfield" || conf.Context != "springfield-staging" {
+		t.Errorf("SetConfigValues() kept %q, %q, want uitml/springfield, springfield-staging", conf.GithubRepo, conf.Context)
+	}
+}
+
+func TestApp_UncachedReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		app     App
+		want    interface{}
+		wantErr bool
+	}{
+		{name: "default", app: App{GithubRepo: "uitml/templates"}, want: &reader.Github{Repo: "uitml/templates", Context: context.Background()}},
+		{name: "default without repo", app: App{}, want: &reader.FS{FS: templates.FS}},
+		{name: "github without repo", app: App{Source: "github"}, wantErr: true},
+		{name: "embedded", app: App{Source: "embedded", GithubRepo: "uitml/templates"}, want: &reader.FS{FS: templates.FS}},
+		{name: "github", app: App{Source: "github", GithubRepo: "uitml/templates"}, want: &reader.Github{Repo: "uitml/templates", Context: context.Background()}},
+		{name: "github enterprise", app: App{GithubRepo: "uitml/templates", GithubURL: "https://github.example.com/api/v3", GithubRef: "v1"},
+			want: &reader.Github{Repo: "uitml/templates", BaseURL: "https://github.example.com/api/v3", Ref: "v1", Context: context.Background()}},
+		{name: "dir", app: App{Source: "dir", SourcePath: "/templates"}, want: &reader.Dir{Root: "/templates"}},
+		{name: "git", app: App{Source: "git", SourcePath: "/templates", SourceRef: "v1"}, want: &reader.Git{Repo: "/templates", Ref: "v1"}},
+		{name: "dir without path", app: App{Source: "dir"}, wantErr: true},
+		{name: "git without path", app: App{Source: "git"}, wantErr: true},
+		{name: "unknown", app: App{Source: "svn"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.app.UncachedReader(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("App.UncachedReader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("App.UncachedReader() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApp_Reader(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cache)
+	defer func() { Global.NoCache = false }()
+
+	tests := []struct {
+		name    string
+		app     App
+		noCache bool
+		want    interface{}
+	}{
+		{
+			name: "github is cached",
+			app:  App{GithubRepo: "uitml/templates", GithubRef: "v1"},
+			want: &reader.Cached{
+				Reader: &reader.Github{Repo: "uitml/templates", Ref: "v1", Context: context.Background()},
+				Dir:    filepath.Join(cache, "quimby"),
+				Key:    "/uitml/templates@v1",
+			},
+		},
+		{
+			name:    "github with --no-cache",
+			app:     App{GithubRepo: "uitml/templates"},
+			noCache: true,
+			want:    &reader.Github{Repo: "uitml/templates", Context: context.Background()},
+		},
+		{
+			name: "dir is not cached",
+			app:  App{Source: "dir", SourcePath: "/templates"},
+			want: &reader.Dir{Root: "/templates"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Global.NoCache = tt.noCache
+			got, err := tt.app.Reader(context.Background())
+			if err != nil {
+				t.Fatalf("App.Reader() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("App.Reader() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApp_TemplateConfigMap(t *testing.T) {
+	tests := []struct {
+		name          string
+		app           App
+		wantNamespace string
+		wantName      string
+		wantErr       bool
+	}{
+		{name: "default", app: App{}, wantNamespace: "quimby-system", wantName: "quimby-templates"},
+		{name: "default for other sources", app: App{Source: "dir", SourcePath: "/templates"}, wantNamespace: "quimby-system", wantName: "quimby-templates"},
+		{name: "configured", app: App{Source: "configmap", SourcePath: "springfield/templates"}, wantNamespace: "springfield", wantName: "templates"},
+		{name: "missing name", app: App{Source: "configmap", SourcePath: "springfield"}, wantErr: true},
+		{name: "empty namespace", app: App{Source: "configmap", SourcePath: "/templates"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			namespace, name, err := tt.app.TemplateConfigMap()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("App.TemplateConfigMap() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if namespace != tt.wantNamespace || name != tt.wantName {
+				t.Errorf("App.TemplateConfigMap() = %v, %v, want %v, %v", namespace, name, tt.wantNamespace, tt.wantName)
+			}
+		})
+	}
+}
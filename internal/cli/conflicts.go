@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/uitml/quimby/internal/k8s"
+)
+
+// ApplyConflicts calls apply, with force if it is set. If the apply fails with conflicts on fields
+// owned by other field managers, the conflicts are shown and, if prompt is set, the user is asked
+// whether to apply again with force. Otherwise the error suggests --force-conflicts.
+func ApplyConflicts(apply func(force bool) error, force bool, prompt bool) error {
+	err := apply(force)
+	var conflict *k8s.ConflictError
+	if force || !errors.As(err, &conflict) {
+		return err
+	}
+	if !prompt {
+		return fmt.Errorf("%w, use --force-conflicts to take them over", err)
+	}
+
+	RenderConflicts(conflict)
+	c, cerr := Confirmation("Take over these fields from their current field managers?", false)
+	if cerr != nil {
+		return cerr
+	}
+	if !c {
+		return fmt.Errorf("%s not applied, its fields are owned by other field managers", conflict.Object)
+	}
+
+	return apply(true)
+}
+
+// Renders a table of the fields of an object owned by other field managers.
+func RenderConflicts(conflict *k8s.ConflictError) {
+	fmt.Printf("%s has fields owned by other field managers, that quimby would change:\n", conflict.Object)
+
+	var rows [][]string
+	for _, c := range conflict.Conflicts {
+		rows = append(rows, []string{c.Field, c.Manager})
+	}
+	RenderTable([][]string{{"Field", "Manager"}}, rows)
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/uitml/quimby/internal/k8s"
+)
+
+func TestApplyConflicts(t *testing.T) {
+	conflict := &k8s.ConflictError{
+		Object:    "ResourceQuota compute-resources",
+		Conflicts: []k8s.Conflict{{Field: ".spec.hard.requests.cpu", Manager: "kubectl"}},
+	}
+	other := errors.New("forbidden")
+
+	tests := []struct {
+		name       string
+		force      bool
+		errs       []error // errors of the applies, in order
+		wantForces []bool
+		wantErr    error
+	}{
+		{name: "Applied", errs: []error{nil}, wantForces: []bool{false}},
+		{name: "Forced", force: true, errs: []error{nil}, wantForces: []bool{true}},
+		{name: "Other error", errs: []error{other}, wantForces: []bool{false}, wantErr: other},
+		{name: "Conflict", errs: []error{conflict}, wantForces: []bool{false}, wantErr: conflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var forces []bool
+			err := ApplyConflicts(func(force bool) error {
+				forces = append(forces, force)
+				return tt.errs[len(forces)-1]
+			}, tt.force, false)
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("ApplyConflicts() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(forces, tt.wantForces) {
+				t.Errorf("ApplyConflicts() applied with force %v, want %v", forces, tt.wantForces)
+			}
+		})
+	}
+}
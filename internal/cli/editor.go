@@ -1,37 +1,132 @@
 package cli
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"strings"
 )
 
-func Editor(in []byte) ([]byte, error) {
-	// Open a temporary file with VI and read the saved file.
-	tmp, err := ioutil.TempFile("", "")
-	if err != nil {
-		return nil, err
+// ErrEditCanceled is returned by Editor when the buffer is saved without changes or emptied.
+var ErrEditCanceled = errors.New("edit cancelled, no changes made")
+
+// Environment variables consulted, in order, to find the editor to use.
+var editorEnvs = []string{"QUIMBY_EDITOR", "VISUAL", "EDITOR"}
+
+const defaultEditor = "vi"
+
+// Returns the editor command given by the environment, falling back to vi.
+func editorCommand() []string {
+	for _, env := range editorEnvs {
+		if args := strings.Fields(os.Getenv(env)); len(args) > 0 {
+			return args
+		}
 	}
-	defer tmp.Close()
 
-	_, err = tmp.Write(in)
-	if err != nil {
-		return nil, err
+	return []string{defaultEditor}
+}
+
+// Prefixes every line in s with "# ".
+func commentLines(s string) []byte {
+	var b bytes.Buffer
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " ")
+		if line == "" {
+			b.WriteString("#\n")
+			continue
+		}
+		b.WriteString("# " + line + "\n")
 	}
 
-	command := exec.Command("vi", tmp.Name())
+	return b.Bytes()
+}
+
+// Removes all full-line comments from in.
+func stripComments(in []byte) []byte {
+	var b bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(in))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		b.WriteString(line + "\n")
+	}
+
+	return b.Bytes()
+}
+
+// Opens path in the user's editor and returns the saved content.
+func runEditor(path string) ([]byte, error) {
+	args := editorCommand()
+	command := exec.Command(args[0], append(args[1:], path)...)
 	command.Stdin = os.Stdin
 	command.Stdout = os.Stdout
-	err = command.Run()
-	if err != nil {
-		return nil, err
+	command.Stderr = os.Stderr
+	if err := command.Run(); err != nil {
+		return nil, fmt.Errorf("editor %s: %w", args[0], err)
 	}
 
-	// Process the file and return the values
-	res, err := ioutil.ReadFile(tmp.Name())
+	return ioutil.ReadFile(path)
+}
+
+// Editor lets the user edit in, kubectl edit style. The header is shown as a comment at the top
+// of the buffer. The edited content, with comments removed, is passed to validate; if it fails,
+// the buffer is reopened with the error inlined until it validates or the user gives up by
+// saving it unchanged. Returns ErrEditCanceled if nothing was changed.
+func Editor(in []byte, header string, validate func([]byte) error) ([]byte, error) {
+	return EditorFrom(in, in, header, validate)
+}
+
+// EditorFrom is Editor starting from in, e.g. a merge of two versions, but where the edit is
+// cancelled only if the result is empty or the same as original. Saving in unchanged accepts it.
+func EditorFrom(original []byte, in []byte, header string, validate func([]byte) error) ([]byte, error) {
+	tmp, err := ioutil.TempFile("", "quimby-edit-*.yaml")
 	if err != nil {
 		return nil, err
 	}
+	defer os.Remove(tmp.Name())
+	if err = tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	original = bytes.TrimSpace(stripComments(original))
+	buffer := append(commentLines(header), in...)
+	var lastFailed []byte
+	for {
+		if err = ioutil.WriteFile(tmp.Name(), buffer, 0600); err != nil {
+			return nil, err
+		}
+
+		res, err := runEditor(tmp.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		edited := stripComments(res)
+		trimmed := bytes.TrimSpace(edited)
+		if len(trimmed) == 0 || bytes.Equal(trimmed, original) {
+			return nil, ErrEditCanceled
+		}
 
-	return res, nil
+		verr := validate(edited)
+		if verr == nil {
+			return edited, nil
+		}
+
+		// Saving the same invalid content twice means the user gave up
+		if lastFailed != nil && bytes.Equal(trimmed, lastFailed) {
+			return nil, verr
+		}
+		lastFailed = trimmed
+
+		buffer = commentLines(header)
+		buffer = append(buffer, commentLines("\nThe edited file is invalid:\n"+verr.Error()+"\n")...)
+		buffer = append(buffer, edited...)
+	}
 }
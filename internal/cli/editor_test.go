@@ -0,0 +1,180 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_editorCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want []string
+	}{
+		{
+			name: "No editor set",
+			env:  map[string]string{},
+			want: []string{"vi"},
+		},
+		{
+			name: "EDITOR set",
+			env:  map[string]string{"EDITOR": "nano"},
+			want: []string{"nano"},
+		},
+		{
+			name: "VISUAL takes precedence over EDITOR",
+			env:  map[string]string{"EDITOR": "nano", "VISUAL": "emacs"},
+			want: []string{"emacs"},
+		},
+		{
+			name: "QUIMBY_EDITOR takes precedence, with arguments",
+			env:  map[string]string{"EDITOR": "nano", "VISUAL": "emacs", "QUIMBY_EDITOR": "code --wait"},
+			want: []string{"code", "--wait"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, env := range editorEnvs {
+				t.Setenv(env, tt.env[env])
+			}
+			if got := editorCommand(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("editorCommand() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_stripComments(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "No comments",
+			in:   "gpu: 2\nstoragesize: 500\n",
+			want: "gpu: 2\nstoragesize: 500\n",
+		},
+		{
+			name: "Header and indented comments",
+			in:   "# header\n#\ngpu: 2\n  # indented\nstoragesize: 500 # trailing\n",
+			want: "gpu: 2\nstoragesize: 500 # trailing\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(stripComments([]byte(tt.in))); got != tt.want {
+				t.Errorf("stripComments() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Installs a fake editor that overwrites the edited file with the given contents, one per invocation.
+func fakeEditor(t *testing.T, contents ...string) {
+	dir := t.TempDir()
+	for i, c := range contents {
+		if err := os.WriteFile(filepath.Join(dir, "edit"+string(rune('0'+i))), []byte(c), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	script := "#!/bin/sh\nn=$(cat " + dir + "/count 2>/dev/null || echo 0)\n" +
+		"cp " + dir + "/edit$n \"$1\"\necho $((n+1)) > " + dir + "/count\n"
+	path := filepath.Join(dir, "editor.sh")
+	if err := os.WriteFile(path, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("QUIMBY_EDITOR", path)
+}
+
+func TestEditor(t *testing.T) {
+	invalid := errors.New("invalid")
+	validate := func(b []byte) error {
+		if string(b) == "bad\n" {
+			return invalid
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name    string
+		edits   []string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "Valid edit",
+			edits: []string{"# header\ngood\n"},
+			want:  "good\n",
+		},
+		{
+			name:    "Unchanged buffer",
+			edits:   []string{"# header\nin\n"},
+			wantErr: ErrEditCanceled,
+		},
+		{
+			name:    "Empty buffer",
+			edits:   []string{"# header\n"},
+			wantErr: ErrEditCanceled,
+		},
+		{
+			name:  "Invalid, then fixed",
+			edits: []string{"bad\n", "good\n"},
+			want:  "good\n",
+		},
+		{
+			name:    "Invalid twice",
+			edits:   []string{"bad\n", "bad\n"},
+			wantErr: invalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeEditor(t, tt.edits...)
+			got, err := Editor([]byte("in\n"), "header", validate)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Editor() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("Editor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditorFrom(t *testing.T) {
+	tests := []struct {
+		name    string
+		edits   []string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "Saved unchanged",
+			edits: []string{"# header\nmerged\n"},
+			want:  "merged\n",
+		},
+		{
+			name:    "Reverted to original",
+			edits:   []string{"# header\noriginal\n"},
+			wantErr: ErrEditCanceled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeEditor(t, tt.edits...)
+			got, err := EditorFrom([]byte("original\n"), []byte("merged\n"), "header", func([]byte) error { return nil })
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("EditorFrom() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("EditorFrom() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
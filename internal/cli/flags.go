@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/uitml/quimby/internal/k8s"
+)
+
+// Global holds the values of the flags shared by all commands.
+var Global struct {
+	Kubeconfig     string
+	Context        string
+	ConfigFile     string
+	Profile        string
+	RequestTimeout time.Duration
+	Timeout        time.Duration
+	QPS            float32
+	Burst          int
+	NoCache        bool
+	Verbose        bool
+}
+
+// AddGlobalFlags registers the flags shared by all commands.
+func AddGlobalFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&Global.Kubeconfig, "kubeconfig", "", "Path to the kubeconfig file to use.")
+	flags.StringVar(&Global.Context, "context", "", "Name of the kubeconfig context to use.")
+	flags.StringVar(&Global.ConfigFile, "config", "", "Config file (default is $HOME/.config/quimby/config.yaml).")
+	flags.StringVar(&Global.Profile, "profile", "", "Name of the config profile to use (default is the current profile).")
+	flags.DurationVar(&Global.RequestTimeout, "request-timeout", 0, "Timeout for a single request to the cluster, 0 means no timeout.")
+	flags.DurationVar(&Global.Timeout, "timeout", 0, "Timeout for the whole command, including prompts, 0 means no timeout.")
+	flags.Float32Var(&Global.QPS, "qps", 0, "Maximum requests per second to the cluster (default is the qps of the config, or 5).")
+	flags.IntVar(&Global.Burst, "burst", 0, "Maximum burst of requests to the cluster (default is the burst of the config, or 10).")
+	flags.BoolVar(&Global.NoCache, "no-cache", false, "Always read templates from their source, bypassing the local cache.")
+	flags.BoolVarP(&Global.Verbose, "verbose", "v", false, "Log retried requests and other details to stderr.")
+}
+
+// Context returns the context of a command, which is cancelled on interrupt, limited by the
+// --timeout flag. The returned function must be called to release it.
+func Context(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if Global.Timeout > 0 {
+		return context.WithTimeout(ctx, Global.Timeout)
+	}
+
+	return context.WithCancel(ctx)
+}
+
+// Returns the options for connecting to the cluster given by the global flags.
+func flagClientOptions() k8s.ClientOptions {
+	return k8s.ClientOptions{
+		Kubeconfig: Global.Kubeconfig,
+		Context:    Global.Context,
+		Timeout:    Global.RequestTimeout,
+		QPS:        Global.QPS,
+		Burst:      Global.Burst,
+		Verbose:    Global.Verbose,
+	}
+}
@@ -7,8 +7,15 @@ import (
 	"strings"
 	"text/tabwriter"
 	"unicode/utf8"
+
+	"github.com/uitml/quimby/internal/resource"
+	"github.com/uitml/quimby/internal/validate"
+	"golang.org/x/term"
 )
 
+// Shared by all prompts, so that buffered input is not lost between them
+var stdin = bufio.NewReader(os.Stdin)
+
 func formatRow(row []string) string {
 	return strings.Join(row, "\t")
 }
@@ -59,7 +66,6 @@ func RenderTable(table ...[][]string) {
 // Default choice defined by 'def'
 func Confirmation(str string, def bool) (bool, error) {
 	var defAns string
-	reader := bufio.NewReader(os.Stdin)
 
 	switch def {
 	case true:
@@ -68,7 +74,7 @@ func Confirmation(str string, def bool) (bool, error) {
 		defAns = "[y/N]"
 	}
 	fmt.Printf("%s %s: ", str, defAns)
-	answer, err := reader.ReadString('\n')
+	answer, err := stdin.ReadString('\n')
 	if err != nil {
 		return false, err
 	}
@@ -83,3 +89,50 @@ func Confirmation(str string, def bool) (bool, error) {
 
 	return def, nil
 }
+
+// Prompts the user for a value. Returns def if the answer is empty.
+func Prompt(str string, def string) (string, error) {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", str, def)
+	} else {
+		fmt.Printf("%s: ", str)
+	}
+	answer, err := stdin.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return validate.DefaultIfEmpty(strings.TrimSpace(answer), def), nil
+}
+
+// Prompts the user for a secret without echoing it, if stdin is a terminal. Returns def if the
+// answer is empty.
+func PromptSecret(str string, def string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return Prompt(str, def)
+	}
+
+	if def != "" {
+		fmt.Printf("%s [unchanged]: ", str)
+	} else {
+		fmt.Printf("%s: ", str)
+	}
+	answer, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+
+	return validate.DefaultIfEmpty(strings.TrimSpace(string(answer)), def), nil
+}
+
+// Renders a table of changes from their current to their new values.
+func RenderChanges(changes []resource.Change) {
+	var rows [][]string
+	for _, c := range changes {
+		rows = append(rows, []string{c.Field, c.Old, c.New})
+	}
+
+	RenderTable([][]string{{"Field", "Current", "New"}}, rows)
+}
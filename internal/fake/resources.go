@@ -1,15 +1,16 @@
 package fake
 
 import (
+	internalresource "github.com/uitml/quimby/internal/resource"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-const (
-	ResourceRequestsGPU corev1.ResourceName = "requests.nvidia.com/gpu"
-	ResourceGPU         corev1.ResourceName = "nvidia.com/gpu"
-)
+// Quota of the GPUs given by the gpu fields of a spec
+var requestsGPU = internalresource.Requests(internalresource.ResourceGPU)
 
 func NewResourceQuotaList(namespace string, cpu int64, gpu int64, memory int64, inverseScaling int64) *corev1.ResourceQuotaList {
 	quota := corev1.ResourceQuotaList{
@@ -30,19 +31,19 @@ func NewResourceQuota(namespace string, cpu int64, gpu int64, memory int64, inve
 		Spec: corev1.ResourceQuotaSpec{
 			Hard: map[corev1.ResourceName]resource.Quantity{
 				corev1.ResourceRequestsCPU:    *resource.NewQuantity(cpu, resource.DecimalSI),
-				ResourceRequestsGPU:           *resource.NewQuantity(gpu, resource.DecimalSI),
+				requestsGPU:                   *resource.NewQuantity(gpu, resource.DecimalSI),
 				corev1.ResourceRequestsMemory: *resource.NewQuantity((memory*1024+256)*1024*1024, resource.BinarySI),
 			},
 		},
 		Status: corev1.ResourceQuotaStatus{
 			Hard: map[corev1.ResourceName]resource.Quantity{
 				corev1.ResourceRequestsCPU:    *resource.NewMilliQuantity(cpu, resource.DecimalSI),
-				ResourceRequestsGPU:           *resource.NewQuantity(gpu, resource.DecimalSI),
+				requestsGPU:                   *resource.NewQuantity(gpu, resource.DecimalSI),
 				corev1.ResourceRequestsMemory: *resource.NewQuantity((memory*1024+256)*1024*1024, resource.BinarySI),
 			},
 			Used: map[corev1.ResourceName]resource.Quantity{
 				corev1.ResourceRequestsCPU:    *resource.NewQuantity(cpu/inverseScaling, resource.DecimalSI),
-				ResourceRequestsGPU:           *resource.NewQuantity(gpu/inverseScaling, resource.DecimalSI),
+				requestsGPU:                   *resource.NewQuantity(gpu/inverseScaling, resource.DecimalSI),
 				corev1.ResourceRequestsMemory: *resource.NewQuantity((memory*1024+256)*1024*1024/inverseScaling, resource.BinarySI),
 			},
 		},
@@ -51,6 +52,39 @@ func NewResourceQuota(namespace string, cpu int64, gpu int64, memory int64, inve
 	return &quota
 }
 
+// NewLimitRange returns the default-resources LimitRange with the given default limits.
+func NewLimitRange(namespace string, defaults corev1.ResourceList) *corev1.LimitRange {
+	lim := corev1.LimitRange{
+		TypeMeta:   metav1.TypeMeta{Kind: "LimitRange", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "default-resources", Namespace: namespace},
+		Spec: corev1.LimitRangeSpec{
+			Limits: []corev1.LimitRangeItem{{Type: corev1.LimitTypeContainer, Default: defaults}},
+		},
+	}
+
+	return &lim
+}
+
+// NewStorageProxy returns the storage-proxy Deployment with the given resources.
+func NewStorageProxy(namespace string, requests corev1.ResourceList, limits corev1.ResourceList) *appsv1.Deployment {
+	dpl := appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment", APIVersion: "apps/v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "storage-proxy", Namespace: namespace},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:      "storage-proxy",
+						Resources: corev1.ResourceRequirements{Requests: requests, Limits: limits},
+					}},
+				},
+			},
+		},
+	}
+
+	return &dpl
+}
+
 func NewPVCList(namespace string, size int64) *corev1.PersistentVolumeClaimList {
 	quota := corev1.PersistentVolumeClaimList{
 		TypeMeta: metav1.TypeMeta{Kind: "PersistentVolumeClaimList", APIVersion: "v1"},
@@ -100,7 +134,7 @@ func NewNodeList(nodeNames []string, gpus []int64, unschedulable []bool) *corev1
 func newNode(name string, gpus int64, isUnschedulable bool) corev1.Node {
 	capacity := map[corev1.ResourceName]resource.Quantity{}
 	if gpus > 0 {
-		capacity = map[corev1.ResourceName]resource.Quantity{ResourceGPU: *resource.NewQuantity(gpus, resource.DecimalSI)}
+		capacity = map[corev1.ResourceName]resource.Quantity{internalresource.ResourceGPU: *resource.NewQuantity(gpus, resource.DecimalSI)}
 	}
 
 	node := corev1.Node{
@@ -112,3 +146,33 @@ func newNode(name string, gpus int64, isUnschedulable bool) corev1.Node {
 
 	return node
 }
+
+// NewGPUNode returns a schedulable node with gpus GPUs of the given product.
+func NewGPUNode(name string, gpus int64, product string) *corev1.Node {
+	node := newNode(name, gpus, false)
+	node.Labels = map[string]string{"nvidia.com/gpu.product": product}
+
+	return &node
+}
+
+// NewAcceleratorNode returns a schedulable node with the given number of each extended resource.
+func NewAcceleratorNode(name string, counts map[corev1.ResourceName]int64) *corev1.Node {
+	node := newNode(name, 0, false)
+	for res, n := range counts {
+		node.Status.Capacity[res] = *resource.NewQuantity(n, resource.DecimalSI)
+	}
+	node.Status.Allocatable = node.Status.Capacity
+
+	return &node
+}
+
+func NewStorageClass(name string, allowVolumeExpansion bool) *storagev1.StorageClass {
+	class := storagev1.StorageClass{
+		TypeMeta:             metav1.TypeMeta{Kind: "StorageClass", APIVersion: "storage.k8s.io/v1"},
+		ObjectMeta:           metav1.ObjectMeta{Name: name},
+		Provisioner:          "nfs",
+		AllowVolumeExpansion: &allowVolumeExpansion,
+	}
+
+	return &class
+}
@@ -1,225 +1,264 @@
 package k8s
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"io"
-	"strings"
+	"fmt"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	applyappsv1 "k8s.io/client-go/applyconfigurations/apps/v1"
 	applycorev1 "k8s.io/client-go/applyconfigurations/core/v1"
 	applyrbacv1 "k8s.io/client-go/applyconfigurations/rbac/v1"
 )
 
-func (c *Client) Apply(namespace string, manifest []byte) error {
-	dec := k8syaml.NewYAMLToJSONDecoder(bytes.NewReader(manifest))
+// Apply applies the objects of a rendered user template to namespace, in order. Objects without
+// a namespace are put in namespace. Nothing is applied if any object is of a kind that is neither
+// supported nor allowed by the client, is in another namespace, or is cluster-scoped other than
+// the Namespace of the user.
+//
+// Objects are applied server-side, with quimby as the field manager. Fields owned by other
+// managers, e.g. changed by an admin with kubectl, fail with a ConflictError unless force is set,
+// in which case quimby takes them over. Every object is applied as a dry run first, so that
+// nothing is changed unless all of them apply without conflicts.
+// See https://kubernetes.io/docs/reference/using-api/server-side-apply/#conflicts
+func (c *Client) Apply(ctx context.Context, namespace string, manifest []byte, force bool) error {
+	return c.apply(ctx, namespace, manifest, force, false)
+}
 
-	var res [][]byte
-	for {
-		var value interface{}
-		err := dec.Decode(&value)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
-		valueBytes, err := json.Marshal(value)
-		if err != nil {
+// DryRunApply returns the error Apply would fail with, without changing anything.
+func (c *Client) DryRunApply(ctx context.Context, namespace string, manifest []byte, force bool) error {
+	return c.apply(ctx, namespace, manifest, force, true)
+}
+
+// Applies manifest as a dry run, and then for real unless dryRun is set.
+func (c *Client) apply(ctx context.Context, namespace string, manifest []byte, force bool, dryRun bool) error {
+	objs, err := Decode(manifest)
+	if err != nil {
+		return err
+	}
+	mappings := make([]*meta.RESTMapping, len(objs))
+	for i, obj := range objs {
+		if mappings[i], err = c.scope(namespace, obj); err != nil {
 			return err
 		}
-
-		res = append(res, valueBytes)
 	}
 
-	// Configure patches
-	for _, m := range res {
-		if strings.Contains(string(m), "kind: Namespace") {
-			err := c.applyNamespace(namespace, m)
-			if err != nil {
-				return err
-			}
-		} else if strings.Contains(string(m), "kind: RoleBinding") {
-			err := c.applyRoleBinding(namespace, m)
-			if err != nil {
-				return err
-			}
-		} else if strings.Contains(string(m), "kind: ResourceQuota") {
-			err := c.applyResourceQuota(namespace, m)
-			if err != nil {
-				return err
-			}
-		} else if strings.Contains(string(m), "kind: LimitRange") {
-			err := c.applyLimitRange(namespace, m)
+	opts := metav1.ApplyOptions{FieldManager: FieldManager, Force: force}
+	apply := map[string]func(context.Context, string, []byte, metav1.ApplyOptions) error{
+		"Namespace":             c.applyNamespace,
+		"RoleBinding":           c.applyRoleBinding,
+		"ResourceQuota":         c.applyResourceQuota,
+		"LimitRange":            c.applyLimitRange,
+		"PersistentVolumeClaim": c.applyPersistentVolumeClaim,
+		"Deployment":            c.applyDeployment,
+		"Service":               c.applyService,
+	}
+	applyAll := func(opts metav1.ApplyOptions) error {
+		for i, obj := range objs {
+			m, err := obj.MarshalJSON()
 			if err != nil {
 				return err
 			}
-		} else if strings.Contains(string(m), "kind: PersistentVolumeClaim") {
-			err := c.applyPersistentVolumeClaim(namespace, m)
-			if err != nil {
-				return err
+			err = c.retry(ctx, "applying "+describe(obj), retryableApply, func() error {
+				if mappings[i] != nil {
+					return c.applyDynamic(ctx, mappings[i], obj, m, opts)
+				}
+				return apply[obj.GetKind()](ctx, namespace, m, opts)
+			})
+			if len(opts.DryRun) > 0 && apierrors.IsNotFound(err) {
+				// The namespace of a new user does not exist until it is applied, and objects in it
+				// cannot conflict
+				continue
 			}
-		} else if strings.Contains(string(m), "kind: Deployment") {
-			err := c.applyDeployment(namespace, m)
 			if err != nil {
-				return err
-			}
-		} else if strings.Contains(string(m), "kind: Service") {
-			err := c.applyService(namespace, m)
-			if err != nil {
-				return err
+				return applyError(describe(obj), err)
 			}
 		}
+		return nil
 	}
 
-	return nil
+	dryRunOpts := opts
+	dryRunOpts.DryRun = []string{metav1.DryRunAll}
+	if err := applyAll(dryRunOpts); err != nil || dryRun {
+		return err
+	}
+
+	return applyAll(opts)
+}
+
+// Checks that obj may be applied to the namespace of a user, and puts namespaced objects without
+// a namespace in it. Returns the mapping to the resource of kinds allowed by the client, which
+// are applied with the dynamic client, and nil for the SupportedKinds.
+func (c *Client) scope(namespace string, obj *unstructured.Unstructured) (*meta.RESTMapping, error) {
+	if obj.GetName() == "" {
+		return nil, fmt.Errorf("%s: metadata.name is not set", obj.GetKind())
+	}
+
+	var mapping *meta.RESTMapping
+	namespaced := obj.GetKind() != "Namespace"
+	if apiVersion, ok := SupportedKinds[obj.GetKind()]; !ok || obj.GetAPIVersion() != apiVersion {
+		gvk := obj.GroupVersionKind()
+		if !c.allowed(gvk) || c.Mapper == nil {
+			return nil, fmt.Errorf("%s: kind %s %q is not supported, and not allowed by the config", describe(obj), obj.GetAPIVersion(), obj.GetKind())
+		}
+		m, err := c.Mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", describe(obj), err)
+		}
+		mapping, namespaced = m, m.Scope.Name() == meta.RESTScopeNameNamespace
+	}
+
+	if err := checkNamespace(namespace, obj, namespaced); err != nil {
+		return nil, err
+	}
+	if namespaced && obj.GetNamespace() == "" {
+		obj.SetNamespace(namespace)
+	}
+
+	return mapping, nil
+}
+
+// Returns true if objects of kind gvk are allowed by the client besides the SupportedKinds.
+func (c *Client) allowed(gvk schema.GroupVersionKind) bool {
+	return containsKind(c.AllowedKinds, gvk)
+}
+
+// Returns true if gvk is one of kinds.
+func containsKind(kinds []schema.GroupVersionKind, gvk schema.GroupVersionKind) bool {
+	for _, k := range kinds {
+		if k == gvk {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Applies obj, of a kind allowed by the client, to its resource with the dynamic client.
+func (c *Client) applyDynamic(ctx context.Context, mapping *meta.RESTMapping, obj *unstructured.Unstructured, manifest []byte, opts metav1.ApplyOptions) error {
+	_, err := c.Dynamic.Resource(mapping.Resource).Namespace(obj.GetNamespace()).Patch(
+		ctx,
+		obj.GetName(),
+		types.ApplyPatchType,
+		manifest,
+		metav1.PatchOptions{DryRun: opts.DryRun, FieldManager: opts.FieldManager, Force: &opts.Force},
+	)
+
+	return err
 }
 
-func (c *Client) applyNamespace(namespace string, manifest []byte) error {
+func (c *Client) applyNamespace(ctx context.Context, namespace string, manifest []byte, opts metav1.ApplyOptions) error {
 	config := applycorev1.NamespaceApplyConfiguration{}
 	err := json.Unmarshal(manifest, &config)
 	if err != nil {
 		return err
 	}
 
-	// Using server-side apply.
-	// Fields are managed and have an owner. Some kubectl fields are managed
-	// by "kubectl", while others are managed by "kubectl-client-side-apply"...
-	// Set Force=true to circumvent that.
-	// See https://kubernetes.io/docs/reference/using-api/server-side-apply/#field-management
 	_, err = c.Clientset.CoreV1().Namespaces().Apply(
-		context.TODO(),
+		ctx,
 		&config,
-		metav1.ApplyOptions{FieldManager: "quimby", Force: true},
+		opts,
 	)
 
 	return err
 }
 
-func (c *Client) applyRoleBinding(namespace string, manifest []byte) error {
+func (c *Client) applyRoleBinding(ctx context.Context, namespace string, manifest []byte, opts metav1.ApplyOptions) error {
 	config := applyrbacv1.RoleBindingApplyConfiguration{}
 	err := json.Unmarshal(manifest, &config)
 	if err != nil {
 		return err
 	}
 
-	// Using server-side apply.
-	// Fields are managed and have an owner. Some kubectl fields are managed
-	// by "kubectl", while others are managed by "kubectl-client-side-apply"...
-	// Set Force=true to circumvent that.
-	// See https://kubernetes.io/docs/reference/using-api/server-side-apply/#field-management
 	_, err = c.Clientset.RbacV1().RoleBindings(namespace).Apply(
-		context.TODO(),
+		ctx,
 		&config,
-		metav1.ApplyOptions{FieldManager: "quimby", Force: true},
+		opts,
 	)
 
 	return err
 }
 
-func (c *Client) applyResourceQuota(namespace string, manifest []byte) error {
+func (c *Client) applyResourceQuota(ctx context.Context, namespace string, manifest []byte, opts metav1.ApplyOptions) error {
 	config := applycorev1.ResourceQuotaApplyConfiguration{}
 	err := json.Unmarshal(manifest, &config)
 	if err != nil {
 		return err
 	}
 
-	// Using server-side apply.
-	// Fields are managed and have an owner. Some kubectl fields are managed
-	// by "kubectl", while others are managed by "kubectl-client-side-apply"...
-	// Set Force=true to circumvent that.
-	// See https://kubernetes.io/docs/reference/using-api/server-side-apply/#field-management
 	_, err = c.Clientset.CoreV1().ResourceQuotas(namespace).Apply(
-		context.TODO(),
+		ctx,
 		&config,
-		metav1.ApplyOptions{FieldManager: "quimby", Force: true},
+		opts,
 	)
 
 	return err
 }
 
-func (c *Client) applyLimitRange(namespace string, manifest []byte) error {
+func (c *Client) applyLimitRange(ctx context.Context, namespace string, manifest []byte, opts metav1.ApplyOptions) error {
 	config := applycorev1.LimitRangeApplyConfiguration{}
 	err := json.Unmarshal(manifest, &config)
 	if err != nil {
 		return err
 	}
 
-	// Using server-side apply.
-	// Fields are managed and have an owner. Some kubectl fields are managed
-	// by "kubectl", while others are managed by "kubectl-client-side-apply"...
-	// Set Force=true to circumvent that.
-	// See https://kubernetes.io/docs/reference/using-api/server-side-apply/#field-management
 	_, err = c.Clientset.CoreV1().LimitRanges(namespace).Apply(
-		context.TODO(),
+		ctx,
 		&config,
-		metav1.ApplyOptions{FieldManager: "quimby", Force: true},
+		opts,
 	)
 
 	return err
 }
 
-func (c *Client) applyPersistentVolumeClaim(namespace string, manifest []byte) error {
+func (c *Client) applyPersistentVolumeClaim(ctx context.Context, namespace string, manifest []byte, opts metav1.ApplyOptions) error {
 	config := applycorev1.PersistentVolumeClaimApplyConfiguration{}
 	err := json.Unmarshal(manifest, &config)
 	if err != nil {
 		return err
 	}
 
-	// Using server-side apply.
-	// Fields are managed and have an owner. Some kubectl fields are managed
-	// by "kubectl", while others are managed by "kubectl-client-side-apply"...
-	// Set Force=true to circumvent that.
-	// See https://kubernetes.io/docs/reference/using-api/server-side-apply/#field-management
 	_, err = c.Clientset.CoreV1().PersistentVolumeClaims(namespace).Apply(
-		context.TODO(),
+		ctx,
 		&config,
-		metav1.ApplyOptions{FieldManager: "quimby", Force: true},
+		opts,
 	)
 
 	return err
 }
 
-func (c *Client) applyDeployment(namespace string, manifest []byte) error {
+func (c *Client) applyDeployment(ctx context.Context, namespace string, manifest []byte, opts metav1.ApplyOptions) error {
 	config := applyappsv1.DeploymentApplyConfiguration{}
 	err := json.Unmarshal(manifest, &config)
 	if err != nil {
 		return err
 	}
 
-	// Using server-side apply.
-	// Fields are managed and have an owner. Some kubectl fields are managed
-	// by "kubectl", while others are managed by "kubectl-client-side-apply"...
-	// Set Force=true to circumvent that.
-	// See https://kubernetes.io/docs/reference/using-api/server-side-apply/#field-management
 	_, err = c.Clientset.AppsV1().Deployments(namespace).Apply(
-		context.TODO(),
+		ctx,
 		&config,
-		metav1.ApplyOptions{FieldManager: "quimby", Force: true},
+		opts,
 	)
 
 	return err
 }
 
-func (c *Client) applyService(namespace string, manifest []byte) error {
+func (c *Client) applyService(ctx context.Context, namespace string, manifest []byte, opts metav1.ApplyOptions) error {
 	config := applycorev1.ServiceApplyConfiguration{}
 	err := json.Unmarshal(manifest, &config)
 	if err != nil {
 		return err
 	}
 
-	// Using server-side apply.
-	// Fields are managed and have an owner. Some kubectl fields are managed
-	// by "kubectl", while others are managed by "kubectl-client-side-apply"...
-	// Set Force=true to circumvent that.
-	// See https://kubernetes.io/docs/reference/using-api/server-side-apply/#field-management
 	_, err = c.Clientset.CoreV1().Services(namespace).Apply(
-		context.TODO(),
+		ctx,
 		&config,
-		metav1.ApplyOptions{FieldManager: "quimby", Force: true},
+		opts,
 	)
 
 	return err
@@ -0,0 +1,207 @@
+package k8s
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestClient_scope(t *testing.T) {
+	networkPolicy := schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "NetworkPolicy"}
+	clusterRole := schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(networkPolicy, meta.RESTScopeNamespace)
+	mapper.Add(clusterRole, meta.RESTScopeRoot)
+
+	tests := []struct {
+		name          string
+		manifest      string
+		wantNamespace string
+		wantDynamic   bool
+		wantErr       bool
+	}{
+		{
+			name:     "User namespace",
+			manifest: "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: foo123\n",
+		},
+		{
+			name:     "Other namespace",
+			manifest: "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: kube-system\n",
+			wantErr:  true,
+		},
+		{
+			name:          "Object in user namespace",
+			manifest:      "apiVersion: v1\nkind: ResourceQuota\nmetadata:\n  name: compute-resources\n  namespace: foo123\n",
+			wantNamespace: "foo123",
+		},
+		{
+			name:          "Object without namespace",
+			manifest:      "apiVersion: v1\nkind: ResourceQuota\nmetadata:\n  name: compute-resources\n",
+			wantNamespace: "foo123",
+		},
+		{
+			name:     "Object in other namespace",
+			manifest: "apiVersion: v1\nkind: ResourceQuota\nmetadata:\n  name: compute-resources\n  namespace: kube-system\n",
+			wantErr:  true,
+		},
+		{
+			name:     "Missing name",
+			manifest: "apiVersion: v1\nkind: Service\nmetadata:\n  namespace: foo123\n",
+			wantErr:  true,
+		},
+		{
+			name:          "Allowed kind",
+			manifest:      "apiVersion: networking.k8s.io/v1\nkind: NetworkPolicy\nmetadata:\n  name: deny-all\n",
+			wantNamespace: "foo123",
+			wantDynamic:   true,
+		},
+		{
+			name:     "Allowed kind in other namespace",
+			manifest: "apiVersion: networking.k8s.io/v1\nkind: NetworkPolicy\nmetadata:\n  name: deny-all\n  namespace: kube-system\n",
+			wantErr:  true,
+		},
+		{
+			name:     "Allowed cluster-scoped kind",
+			manifest: "apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\nmetadata:\n  name: admin\n",
+			wantErr:  true,
+		},
+		{
+			name:     "Kind not allowed",
+			manifest: "apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRoleBinding\nmetadata:\n  name: admin\n",
+			wantErr:  true,
+		},
+		{
+			name:     "Supported kind with other API version",
+			manifest: "apiVersion: apps/v1beta1\nkind: Deployment\nmetadata:\n  name: storage-proxy\n",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs, err := Decode([]byte(tt.manifest))
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := &Client{AllowedKinds: []schema.GroupVersionKind{networkPolicy, clusterRole}, Mapper: mapper}
+			mapping, err := c.scope("foo123", objs[0])
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Client.scope() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := objs[0].GetNamespace(); got != tt.wantNamespace {
+				t.Errorf("Client.scope() namespace = %q, want %q", got, tt.wantNamespace)
+			}
+			if (mapping != nil) != tt.wantDynamic {
+				t.Errorf("Client.scope() mapping = %v, want dynamic %v", mapping, tt.wantDynamic)
+			}
+		})
+	}
+}
+
+func TestClient_Apply_refused(t *testing.T) {
+	manifest := []byte(`
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: foo123
+---
+apiVersion: v1
+kind: ResourceQuota
+metadata:
+  name: compute-resources
+  namespace: kube-system
+`)
+
+	clientset := fake.NewSimpleClientset()
+	c := &Client{Clientset: clientset}
+	err := c.Apply(context.Background(), "foo123", manifest, false)
+	if err == nil || !strings.Contains(err.Error(), "kube-system") {
+		t.Errorf("Client.Apply() error = %v, want the namespace refused", err)
+	}
+	if actions := clientset.Actions(); len(actions) > 0 {
+		t.Errorf("Client.Apply() sent %d requests, want none", len(actions))
+	}
+}
+
+func TestClient_Apply_allowedKind(t *testing.T) {
+	networkPolicy := schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "NetworkPolicy"}
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(networkPolicy, meta.RESTScopeNamespace)
+
+	dyn := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	var patched []string
+	dyn.PrependReactor("patch", "networkpolicies", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		patched = append(patched, patch.GetNamespace()+"/"+patch.GetName())
+		return true, nil, nil
+	})
+
+	c := &Client{
+		Clientset:    fake.NewSimpleClientset(),
+		AllowedKinds: []schema.GroupVersionKind{networkPolicy},
+		Dynamic:      dyn,
+		Mapper:       mapper,
+	}
+	manifest := []byte("apiVersion: networking.k8s.io/v1\nkind: NetworkPolicy\nmetadata:\n  name: deny-all\n")
+	if err := c.Apply(context.Background(), "foo123", manifest, false); err != nil {
+		t.Fatalf("Client.Apply() error = %v", err)
+	}
+	// A dry run, then the apply
+	if want := []string{"foo123/deny-all", "foo123/deny-all"}; !reflect.DeepEqual(patched, want) {
+		t.Errorf("Client.Apply() applied %v, want %v", patched, want)
+	}
+}
+
+func TestClient_Apply_conflict(t *testing.T) {
+	manifest := append(templateNamespace("Foo Bar", "foo@uit.no", "student"), []byte(`---
+apiVersion: v1
+kind: ResourceQuota
+metadata:
+  name: compute-resources
+`)...)
+
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("patch", "resourcequotas", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		causes := []metav1.StatusCause{{Type: metav1.CauseTypeFieldManagerConflict, Message: `conflict with "kubectl-edit"`, Field: ".spec.hard.cpu"}}
+		return true, nil, apierrors.NewApplyConflict(causes, "Apply failed with 1 conflict")
+	})
+	n := newApplyNamespaces()
+	c := &Client{Clientset: &applyClientset{Clientset: clientset, namespaces: n}}
+
+	err := c.Apply(context.Background(), "foo123", manifest, false)
+	if _, ok := err.(*ConflictError); !ok {
+		t.Fatalf("Client.Apply() error = %v, want a ConflictError", err)
+	}
+	if len(n.values) > 0 {
+		t.Errorf("Client.Apply() applied the namespace %v before the conflict", n.values)
+	}
+}
+
+func TestClient_DryRunApply(t *testing.T) {
+	n := newApplyNamespaces()
+	n.set(".metadata.labels."+LabelUserType, "staff", "kubectl")
+	c := &Client{Clientset: &applyClientset{Clientset: fake.NewSimpleClientset(), namespaces: n}}
+
+	err := c.DryRunApply(context.Background(), "foo123", templateNamespace("Foo Bar", "foo@uit.no", "student"), false)
+	if _, ok := err.(*ConflictError); !ok {
+		t.Fatalf("Client.DryRunApply() error = %v, want a ConflictError", err)
+	}
+	if err := c.DryRunApply(context.Background(), "foo123", templateNamespace("Foo Bar", "foo@uit.no", "student"), true); err != nil {
+		t.Fatalf("Client.DryRunApply() with force error = %v", err)
+	}
+	if want := map[string]string{".metadata.labels." + LabelUserType: "staff"}; !reflect.DeepEqual(n.values, want) {
+		t.Errorf("Client.DryRunApply() changed the namespace to %v", n.values)
+	}
+}
@@ -1,36 +1,151 @@
 package k8s
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
 	"github.com/uitml/quimby/internal/resource"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
 type ResourceClient interface {
-	NamespaceList() (*corev1.NamespaceList, error)
-	Quota(string) (resource.Quota, error)
-	Spec(string) (*resource.Spec, error)
-	DefaultRequest(string) (resource.Request, error)
-	Namespace(string) (*corev1.Namespace, error)
-	ApplyMetadata(string, string, string, string) error
-	Apply(string, []byte) error
-	TotalGPUs() (resource.Summary, error)
-	UserExists(string) (bool, error)
-	DeleteUser(string) error
+	NamespaceList(context.Context) (*corev1.NamespaceList, error)
+	Users(context.Context, string) ([]corev1.Namespace, error)
+	Quota(context.Context, string) (resource.Quota, error)
+	Spec(context.Context, string) (*resource.Spec, error)
+	VersionedSpec(context.Context, string) (*resource.Spec, Versions, error)
+	DefaultRequest(context.Context, string) (resource.Request, error)
+	Namespace(context.Context, string) (*corev1.Namespace, error)
+	ApplyMetadata(context.Context, string, string, string, string, bool) error
+	Apply(context.Context, string, []byte, bool) error
+	DryRunApply(context.Context, string, []byte, bool) error
+	TotalGPUs(context.Context) (resource.Capacity, error)
+	Cluster(context.Context) (resource.Cluster, error)
+	UserExists(context.Context, string) (bool, error)
+	DeleteUser(context.Context, string) error
+	ResizeStorage(context.Context, string, apiresource.Quantity, time.Duration) error
+	ServerVersion(context.Context) (string, error)
+	Groups(context.Context) ([]string, error)
+	ConfigMap(context.Context, string, string) (*corev1.ConfigMap, error)
+	ApplyConfigMap(context.Context, string, string, map[string]string, bool) error
 }
 
 type Client struct {
 	Clientset kubernetes.Interface
+
+	// Extended resources of the accelerators besides nvidia.com/gpu, e.g. MIG slices
+	Accelerators []corev1.ResourceName
+
+	// Kinds besides the SupportedKinds that Apply may apply to the namespace of a user, with the
+	// dynamic client they are applied with and the mapper to their resources
+	AllowedKinds []schema.GroupVersionKind
+	Dynamic      dynamic.Interface
+	Mapper       meta.RESTMapper
+
+	// Backoff of requests that fail with a transient error, DefaultBackoff if empty
+	Backoff wait.Backoff
+
+	// Logs verbose messages such as retries, nil to discard them
+	Logf func(format string, args ...interface{})
 }
 
-func NewClient() (ResourceClient, error) {
+// ClientOptions configures how NewClient connects to the cluster. Empty values fall back to the
+// defaults of kubectl.
+type ClientOptions struct {
+	Kubeconfig string
+	Context    string
+	Timeout    time.Duration
+
+	// Maximum sustained requests per second and burst of requests to the API server
+	QPS   float32
+	Burst int
+
+	// Log retries and other details to stderr
+	Verbose bool
+
+	// Accelerators besides nvidia.com/gpu to read the quotas and capacity of
+	Accelerators []corev1.ResourceName
+
+	// Kinds besides the SupportedKinds that Apply may apply
+	AllowedKinds []schema.GroupVersionKind
+}
+
+func NewClient(opts ClientOptions) (ResourceClient, error) {
 	rules := clientcmd.NewDefaultClientConfigLoadingRules()
-	kubeconfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{})
+	rules.ExplicitPath = opts.Kubeconfig
+
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: opts.Context}
+	if opts.Timeout > 0 {
+		overrides.Timeout = opts.Timeout.String()
+	}
+
+	kubeconfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
 	config, err := kubeconfig.ClientConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	return &Client{kubernetes.NewForConfigOrDie(config)}, nil
+	if opts.QPS > 0 {
+		config.QPS = opts.QPS
+	}
+	if opts.Burst > 0 {
+		config.Burst = opts.Burst
+	}
+
+	clientset := kubernetes.NewForConfigOrDie(config)
+	dyn, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		Clientset:    clientset,
+		Accelerators: opts.Accelerators,
+		AllowedKinds: opts.AllowedKinds,
+		Dynamic:      dyn,
+		Mapper:       restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(clientset.Discovery())),
+	}
+	if opts.Verbose {
+		c.Logf = func(format string, args ...interface{}) {
+			fmt.Fprintf(os.Stderr, format+"\n", args...)
+		}
+	}
+
+	return c, nil
+}
+
+// ServerVersion returns the Kubernetes version of the cluster. The discovery client takes no
+// context, so the request is abandoned rather than cancelled once ctx is done.
+func (c *Client) ServerVersion(ctx context.Context) (string, error) {
+	type result struct {
+		version string
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		v, err := c.Clientset.Discovery().ServerVersion()
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		done <- result{version: v.GitVersion}
+	}()
+
+	select {
+	case r := <-done:
+		return r.version, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
 }
@@ -0,0 +1,39 @@
+package k8s
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	applycorev1 "k8s.io/client-go/applyconfigurations/core/v1"
+)
+
+// ConfigMap returns the ConfigMap name in namespace.
+func (c *Client) ConfigMap(ctx context.Context, namespace string, name string) (cm *corev1.ConfigMap, err error) {
+	err = c.retry(ctx, "getting ConfigMap "+namespace+"/"+name, Retryable, func() error {
+		cm, err = c.Clientset.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+
+	return cm, err
+}
+
+// ApplyConfigMap creates or updates the ConfigMap name in namespace, replacing its data. Keys
+// owned by other field managers fail with a ConflictError, unless force is set.
+func (c *Client) ApplyConfigMap(ctx context.Context, namespace string, name string, data map[string]string, force bool) error {
+	config := applycorev1.ConfigMap(name, namespace).WithData(data)
+
+	err := c.retry(ctx, "applying ConfigMap "+namespace+"/"+name, retryableApply, func() error {
+		_, err := c.Clientset.CoreV1().ConfigMaps(namespace).Apply(
+			ctx,
+			config,
+			metav1.ApplyOptions{FieldManager: FieldManager, Force: force},
+		)
+		return err
+	})
+	if err != nil {
+		return applyError("ConfigMap "+name, err)
+	}
+
+	return nil
+}
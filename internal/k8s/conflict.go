@@ -0,0 +1,93 @@
+package k8s
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// FieldManager owns the fields of the objects of the user template written by quimby.
+	FieldManager = "quimby"
+
+	// MetadataFieldManager owns the user type label and the full name and e-mail annotations of
+	// the namespace of a user, as set by ApplyMetadata. It is kept apart from FieldManager, as
+	// server-side apply removes the fields a manager owned but leaves out of its next apply.
+	MetadataFieldManager = "quimby-metadata"
+)
+
+// Conflict is a field that an apply would change, but is owned by another field manager.
+type Conflict struct {
+	Field   string
+	Manager string
+}
+
+// ConflictError is returned when an apply would change fields owned by other field managers,
+// e.g. an admin that edited the object with kubectl. Applying with force takes over the fields.
+type ConflictError struct {
+	Object    string // kind and name of the object, e.g. ResourceQuota compute-resources
+	Conflicts []Conflict
+
+	err error
+}
+
+func (e *ConflictError) Error() string {
+	var fields []string
+	for _, c := range e.Conflicts {
+		fields = append(fields, fmt.Sprintf("%s (%s)", c.Field, c.Manager))
+	}
+
+	return fmt.Sprintf("%s: fields are owned by other field managers: %s", e.Object, strings.Join(fields, ", "))
+}
+
+func (e *ConflictError) Unwrap() error {
+	return e.err
+}
+
+// Returns the field manager conflicts of err, which are given as causes of the status.
+func conflicts(err error) []Conflict {
+	var status apierrors.APIStatus
+	if !apierrors.IsConflict(err) || !errors.As(err, &status) || status.Status().Details == nil {
+		return nil
+	}
+
+	var result []Conflict
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type != metav1.CauseTypeFieldManagerConflict {
+			continue
+		}
+		result = append(result, Conflict{Field: cause.Field, Manager: conflictManager(cause.Message)})
+	}
+
+	return result
+}
+
+// Returns the name of the manager in the message of a conflict, e.g. kubectl for
+// `conflict with "kubectl" using v1`. Returns the message if it is not in that form.
+func conflictManager(message string) string {
+	rest := strings.TrimPrefix(message, "conflict with ")
+	quoted, err := strconv.QuotedPrefix(rest)
+	if err != nil {
+		return message
+	}
+	manager, err := strconv.Unquote(quoted)
+	if err != nil {
+		return message
+	}
+
+	return manager
+}
+
+// Returns err as a ConflictError if it is a field manager conflict, and prefixed with object
+// otherwise.
+func applyError(object string, err error) error {
+	if c := conflicts(err); len(c) > 0 {
+		return &ConflictError{Object: object, Conflicts: c, err: err}
+	}
+
+	return fmt.Errorf("%s: %w", object, err)
+}
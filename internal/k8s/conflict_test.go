@@ -0,0 +1,98 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestConflictManager(t *testing.T) {
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{`conflict with "kubectl"`, "kubectl"},
+		{`conflict with "kubectl-edit" using v1`, "kubectl-edit"},
+		{`conflict with "helm" using apps/v1 at 2022-03-01T10:00:00Z`, "helm"},
+		{`conflict with "kubectl" with subresource "status"`, "kubectl"},
+		{"something else", "something else"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			if got := conflictManager(tt.message); got != tt.want {
+				t.Errorf("conflictManager() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyError(t *testing.T) {
+	gr := schema.GroupResource{Resource: "resourcequotas"}
+	fieldConflict := apierrors.NewApplyConflict([]metav1.StatusCause{
+		{Type: metav1.CauseTypeFieldManagerConflict, Message: `conflict with "kubectl-edit" using v1`, Field: ".spec.hard.requests.nvidia.com/gpu"},
+		{Type: metav1.CauseTypeFieldManagerConflict, Message: `conflict with "kubectl"`, Field: ".spec.hard.requests.cpu"},
+	}, "Apply failed with 2 conflicts")
+
+	tests := []struct {
+		name string
+		err  error
+		want []Conflict // nil if the error is not a ConflictError
+	}{
+		{
+			name: "Field manager conflicts",
+			err:  fieldConflict,
+			want: []Conflict{
+				{Field: ".spec.hard.requests.nvidia.com/gpu", Manager: "kubectl-edit"},
+				{Field: ".spec.hard.requests.cpu", Manager: "kubectl"},
+			},
+		},
+		{name: "Other conflict", err: apierrors.NewConflict(gr, "compute-resources", errors.New("changed"))},
+		{name: "Other error", err: apierrors.NewForbidden(gr, "compute-resources", errors.New("no"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := applyError("ResourceQuota compute-resources", tt.err)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("applyError() = %v, does not wrap %v", err, tt.err)
+			}
+
+			var conflict *ConflictError
+			if !errors.As(err, &conflict) {
+				if tt.want != nil {
+					t.Fatalf("applyError() = %v, want a ConflictError", err)
+				}
+				return
+			}
+			if !reflect.DeepEqual(conflict.Conflicts, tt.want) {
+				t.Errorf("applyError() conflicts = %v, want %v", conflict.Conflicts, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_ApplyMetadata_conflict(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("patch", "namespaces", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewApplyConflict([]metav1.StatusCause{
+			{Type: metav1.CauseTypeFieldManagerConflict, Message: `conflict with "kubectl-label"`, Field: ".metadata.labels.springfield.uit.no/user-type"},
+		}, "Apply failed with 1 conflict")
+	})
+
+	c := &Client{Clientset: clientset}
+	err := c.ApplyMetadata(context.Background(), "foo123", "Foo Bar", "foo@uit.no", "phd", false)
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("Client.ApplyMetadata() error = %v, want a ConflictError", err)
+	}
+	if conflict.Object != "Namespace foo123" || len(conflict.Conflicts) != 1 {
+		t.Errorf("Client.ApplyMetadata() error = %+v, want one conflict on Namespace foo123", conflict)
+	}
+}
@@ -0,0 +1,215 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	applycorev1 "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// Simulates server-side apply of the labels and annotations of a namespace, which the fake
+// clientset does not implement. Each field is owned by the managers that applied it with its
+// current value, and is removed once none of them applies it anymore.
+type applyNamespaces struct {
+	corev1client.NamespaceInterface
+	values map[string]string          // by field, e.g. .metadata.labels.springfield.uit.no/user-type
+	owners map[string]map[string]bool // managers of each field
+}
+
+func newApplyNamespaces() *applyNamespaces {
+	return &applyNamespaces{values: make(map[string]string), owners: make(map[string]map[string]bool)}
+}
+
+// Sets a field as owned by manager, e.g. from an apply of an earlier version of quimby.
+func (n *applyNamespaces) set(field string, value string, manager string) {
+	n.values[field] = value
+	n.owners[field] = map[string]bool{manager: true}
+}
+
+func (n *applyNamespaces) Apply(ctx context.Context, config *applycorev1.NamespaceApplyConfiguration, opts metav1.ApplyOptions) (*corev1.Namespace, error) {
+	fields := make(map[string]string)
+	for k, v := range config.Labels {
+		fields[".metadata.labels."+k] = v
+	}
+	for k, v := range config.Annotations {
+		fields[".metadata.annotations."+k] = v
+	}
+
+	var causes []metav1.StatusCause
+	for field, v := range fields {
+		if old, ok := n.values[field]; !ok || old == v {
+			continue
+		}
+		for m := range n.owners[field] {
+			if m != opts.FieldManager {
+				causes = append(causes, metav1.StatusCause{
+					Type: metav1.CauseTypeFieldManagerConflict, Message: fmt.Sprintf("conflict with %q", m), Field: field,
+				})
+			}
+		}
+	}
+	if len(causes) > 0 && !opts.Force {
+		return nil, apierrors.NewApplyConflict(causes, fmt.Sprintf("Apply failed with %d conflicts", len(causes)))
+	}
+	if len(opts.DryRun) > 0 {
+		return &corev1.Namespace{}, nil
+	}
+
+	for field, owners := range n.owners {
+		if _, ok := fields[field]; !ok && owners[opts.FieldManager] {
+			delete(owners, opts.FieldManager)
+			if len(owners) == 0 {
+				delete(n.owners, field)
+				delete(n.values, field)
+			}
+		}
+	}
+	for field, v := range fields {
+		if n.values[field] != v || n.owners[field] == nil {
+			// Changing a value takes it over from the other managers
+			n.owners[field] = make(map[string]bool)
+		}
+		n.values[field] = v
+		n.owners[field][opts.FieldManager] = true
+	}
+
+	return &corev1.Namespace{}, nil
+}
+
+// Clientset whose namespaces are applyNamespaces.
+type applyClientset struct {
+	*fake.Clientset
+	namespaces *applyNamespaces
+}
+
+func (c *applyClientset) CoreV1() corev1client.CoreV1Interface {
+	return &applyCoreV1{CoreV1Interface: c.Clientset.CoreV1(), namespaces: c.namespaces}
+}
+
+type applyCoreV1 struct {
+	corev1client.CoreV1Interface
+	namespaces *applyNamespaces
+}
+
+func (c *applyCoreV1) Namespaces() corev1client.NamespaceInterface {
+	return c.namespaces
+}
+
+// Returns the Namespace of foo123 as the user template renders it, restricted to a GPU model.
+func templateNamespace(fullname string, email string, usertype string) []byte {
+	return []byte(fmt.Sprintf(`apiVersion: v1
+kind: Namespace
+metadata:
+  name: foo123
+  labels:
+    springfield.uit.no/user-type: %q
+  annotations:
+    springfield.uit.no/user-fullname: %q
+    springfield.uit.no/user-email: %q
+    springfield.uit.no/gpu-models: "NVIDIA-A100-SXM4-40GB"
+    scheduler.alpha.kubernetes.io/node-selector: "nvidia.com/gpu.product=NVIDIA-A100-SXM4-40GB"
+`, usertype, fullname, email))
+}
+
+func TestClient_ApplyMetadata_fieldManagers(t *testing.T) {
+	const (
+		usertype = ".metadata.labels." + LabelUserType
+		fullname = ".metadata.annotations." + AnnotationUserFullname
+		email    = ".metadata.annotations." + AnnotationUserEmail
+		models   = ".metadata.annotations." + AnnotationGPUModels
+		selector = ".metadata.annotations.scheduler.alpha.kubernetes.io/node-selector"
+	)
+	// Every field of the namespace after the metadata has been changed to Foo Baz, phd
+	want := map[string]string{
+		usertype: "phd",
+		fullname: "Foo Baz",
+		email:    "foo@uit.no",
+		models:   "NVIDIA-A100-SXM4-40GB",
+		selector: "nvidia.com/gpu.product=NVIDIA-A100-SXM4-40GB",
+	}
+
+	tests := []struct {
+		name  string
+		setup func(c *Client, n *applyNamespaces) error
+	}{
+		{
+			// quimby new, then edit meta and edit quota, which renders the current metadata
+			name: "Edit meta, then edit quota",
+			setup: func(c *Client, n *applyNamespaces) error {
+				if err := c.Apply(context.Background(), "foo123", templateNamespace("Foo Bar", "foo@uit.no", "student"), false); err != nil {
+					return err
+				}
+				if err := c.ApplyMetadata(context.Background(), "foo123", "Foo Baz", "foo@uit.no", "phd", false); err != nil {
+					return err
+				}
+				return c.Apply(context.Background(), "foo123", templateNamespace("Foo Baz", "foo@uit.no", "phd"), false)
+			},
+		},
+		{
+			name: "Edit quota, then edit meta",
+			setup: func(c *Client, n *applyNamespaces) error {
+				if err := c.Apply(context.Background(), "foo123", templateNamespace("Foo Bar", "foo@uit.no", "student"), false); err != nil {
+					return err
+				}
+				if err := c.Apply(context.Background(), "foo123", templateNamespace("Foo Bar", "foo@uit.no", "student"), false); err != nil {
+					return err
+				}
+				return c.ApplyMetadata(context.Background(), "foo123", "Foo Baz", "foo@uit.no", "phd", false)
+			},
+		},
+		{
+			// Earlier versions of quimby set the metadata as kubectl, which must be taken over once
+			name: "Metadata of earlier versions",
+			setup: func(c *Client, n *applyNamespaces) error {
+				n.set(usertype, "student", "kubectl")
+				n.set(fullname, "Foo Bar", "kubectl")
+				n.set(email, "foo@uit.no", "kubectl")
+				n.set(models, "NVIDIA-A100-SXM4-40GB", FieldManager)
+				n.set(selector, "nvidia.com/gpu.product=NVIDIA-A100-SXM4-40GB", FieldManager)
+				err := c.ApplyMetadata(context.Background(), "foo123", "Foo Baz", "foo@uit.no", "phd", false)
+				if _, ok := err.(*ConflictError); !ok {
+					return fmt.Errorf("got %v without force, want a ConflictError", err)
+				}
+				return c.ApplyMetadata(context.Background(), "foo123", "Foo Baz", "foo@uit.no", "phd", true)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newApplyNamespaces()
+			c := &Client{Clientset: &applyClientset{Clientset: fake.NewSimpleClientset(), namespaces: n}}
+			if err := tt.setup(c, n); err != nil {
+				t.Fatalf("apply error = %v", err)
+			}
+			if !reflect.DeepEqual(n.values, want) {
+				t.Errorf("namespace fields = %v, want %v", n.values, want)
+			}
+		})
+	}
+}
+
+func TestClient_ApplyMetadata_otherManager(t *testing.T) {
+	// kubectl is the field manager of kubectl apply, and kubectl-label of kubectl label
+	for _, manager := range []string{"kubectl", "kubectl-label"} {
+		t.Run(manager, func(t *testing.T) {
+			n := newApplyNamespaces()
+			n.set(".metadata.labels."+LabelUserType, "staff", manager)
+			c := &Client{Clientset: &applyClientset{Clientset: fake.NewSimpleClientset(), namespaces: n}}
+
+			err := c.ApplyMetadata(context.Background(), "foo123", "Foo Bar", "foo@uit.no", "phd", false)
+			if _, ok := err.(*ConflictError); !ok {
+				t.Fatalf("Client.ApplyMetadata() error = %v, want a ConflictError", err)
+			}
+			if got := n.values[".metadata.labels."+LabelUserType]; got != "staff" {
+				t.Errorf("Client.ApplyMetadata() changed the user type to %s without force", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// API versions of SelfSubjectReview, which is v1 from Kubernetes 1.28 and v1beta1 in 1.27. The
+// client has no typed client for it, so it is posted as JSON.
+var selfSubjectReviewVersions = []string{"v1", "v1beta1"}
+
+// Groups returns the groups of the current user, as authenticated by the cluster rather than
+// declared in the kubeconfig or the quimby config.
+func (c *Client) Groups(ctx context.Context) ([]string, error) {
+	for _, version := range selfSubjectReviewVersions {
+		body := []byte(`{"apiVersion":"authentication.k8s.io/` + version + `","kind":"SelfSubjectReview"}`)
+		var raw []byte
+		err := c.retry(ctx, "reviewing the current user", Retryable, func() (err error) {
+			raw, err = c.Clientset.AuthenticationV1().RESTClient().Post().
+				AbsPath("/apis/authentication.k8s.io", version, "selfsubjectreviews").
+				SetHeader("Content-Type", "application/json").
+				Body(body).
+				DoRaw(ctx)
+			return err
+		})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		review := struct {
+			Status struct {
+				UserInfo authenticationv1.UserInfo `json:"userInfo"`
+			} `json:"status"`
+		}{}
+		if err := json.Unmarshal(raw, &review); err != nil {
+			return nil, fmt.Errorf("SelfSubjectReview: %w", err)
+		}
+		return review.Status.UserInfo.Groups, nil
+	}
+
+	return nil, fmt.Errorf("the cluster does not support SelfSubjectReview, which requires Kubernetes 1.27 or later")
+}
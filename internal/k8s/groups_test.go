@@ -0,0 +1,56 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestClient_Groups(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions []string // served versions of SelfSubjectReview
+		want     []string
+		wantErr  bool
+	}{
+		{name: "v1", versions: []string{"v1", "v1beta1"}, want: []string{"springfield-admins", "system:authenticated"}},
+		{name: "v1beta1", versions: []string{"v1beta1"}, want: []string{"springfield-admins", "system:authenticated"}},
+		{name: "Not supported", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			for _, v := range tt.versions {
+				v := v
+				mux.HandleFunc("/apis/authentication.k8s.io/"+v+"/selfsubjectreviews", func(w http.ResponseWriter, r *http.Request) {
+					if r.Method != http.MethodPost {
+						http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+						return
+					}
+					w.Header().Set("Content-Type", "application/json")
+					fmt.Fprintf(w, `{"apiVersion":"authentication.k8s.io/%s","kind":"SelfSubjectReview","status":{"userInfo":{"username":"admin","groups":["springfield-admins","system:authenticated"]}}}`, v)
+				})
+			}
+			server := httptest.NewServer(mux)
+			defer server.Close()
+			clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := (&Client{Clientset: clientset}).Groups(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Client.Groups() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Client.Groups() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package k8s
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// SupportedKinds maps the kinds Apply can apply to their API version. All are namespaced, except
+// for the Namespace of the user. Other kinds must be allowed in the config.
+var SupportedKinds = map[string]string{
+	"Namespace":             "v1",
+	"ResourceQuota":         "v1",
+	"LimitRange":            "v1",
+	"PersistentVolumeClaim": "v1",
+	"Service":               "v1",
+	"Deployment":            "apps/v1",
+	"RoleBinding":           "rbac.authorization.k8s.io/v1",
+}
+
+// Returns an empty typed object of a supported kind, used to check the fields of a document.
+var typedObjects = map[string]func() interface{}{
+	"Namespace":             func() interface{} { return &corev1.Namespace{} },
+	"ResourceQuota":         func() interface{} { return &corev1.ResourceQuota{} },
+	"LimitRange":            func() interface{} { return &corev1.LimitRange{} },
+	"PersistentVolumeClaim": func() interface{} { return &corev1.PersistentVolumeClaim{} },
+	"Service":               func() interface{} { return &corev1.Service{} },
+	"Deployment":            func() interface{} { return &appsv1.Deployment{} },
+	"RoleBinding":           func() interface{} { return &rbacv1.RoleBinding{} },
+}
+
+// Decode returns the objects of a multi-document YAML or JSON manifest. Empty documents are skipped.
+func Decode(manifest []byte) ([]*unstructured.Unstructured, error) {
+	dec := k8syaml.NewYAMLOrJSONDecoder(bytes.NewReader(manifest), 4096)
+
+	var objs []*unstructured.Unstructured
+	for i := 0; ; i++ {
+		obj := &unstructured.Unstructured{}
+		err := dec.Decode(&obj.Object)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i+1, err)
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+		objs = append(objs, obj)
+	}
+
+	return objs, nil
+}
+
+// Returns a short description of obj for messages, e.g. ResourceQuota compute-resources.
+func describe(obj *unstructured.Unstructured) string {
+	return obj.GetKind() + " " + obj.GetName()
+}
+
+// ValidateObject checks that obj is a well-formed object of a supported kind, without unknown
+// fields, that belongs to the user namespace. Objects of the allowed kinds, which Apply applies
+// as well, are only checked for a name and the namespace, as namespaced objects. Apply also
+// rejects allowed kinds that turn out to be cluster-scoped, which takes the cluster to tell.
+func ValidateObject(namespace string, obj *unstructured.Unstructured, allowed []schema.GroupVersionKind) error {
+	kind := obj.GetKind()
+	apiVersion, ok := SupportedKinds[kind]
+	if (!ok || obj.GetAPIVersion() != apiVersion) && containsKind(allowed, obj.GroupVersionKind()) {
+		if obj.GetName() == "" {
+			return fmt.Errorf("%s: metadata.name is not set", kind)
+		}
+		return checkNamespace(namespace, obj, true)
+	}
+	if !ok {
+		return fmt.Errorf("%s: kind %q is not supported", describe(obj), kind)
+	}
+	if obj.GetAPIVersion() != apiVersion {
+		return fmt.Errorf("%s: apiVersion is %q, want %q", describe(obj), obj.GetAPIVersion(), apiVersion)
+	}
+	if obj.GetName() == "" {
+		return fmt.Errorf("%s: metadata.name is not set", kind)
+	}
+
+	if err := checkNamespace(namespace, obj, kind != "Namespace"); err != nil {
+		return err
+	}
+
+	b, err := obj.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(typedObjects[kind]()); err != nil {
+		return fmt.Errorf("%s: %w", describe(obj), err)
+	}
+
+	return nil
+}
+
+// Returns an error unless obj stays within the namespace of a user: namespaced objects must be in
+// namespace or have no namespace, and the only cluster-scoped object allowed is the Namespace of
+// the user itself.
+func checkNamespace(namespace string, obj *unstructured.Unstructured, namespaced bool) error {
+	if !namespaced {
+		if obj.GetKind() != "Namespace" || obj.GetAPIVersion() != "v1" {
+			return fmt.Errorf("%s: cluster-scoped objects other than the namespace of the user are not allowed", describe(obj))
+		}
+		if obj.GetName() != namespace {
+			return fmt.Errorf("%s: only the namespace %s of the user can be created", describe(obj), namespace)
+		}
+		return nil
+	}
+
+	if ns := obj.GetNamespace(); ns != "" && ns != namespace {
+		return fmt.Errorf("%s: namespace is %s, want the namespace %s of the user", describe(obj), ns, namespace)
+	}
+
+	return nil
+}
+
+// ParseKind parses a kind given as apiVersion/Kind, e.g. networking.k8s.io/v1/NetworkPolicy or
+// v1/ConfigMap.
+func ParseKind(s string) (schema.GroupVersionKind, error) {
+	i := strings.LastIndex(s, "/")
+	if i <= 0 || i == len(s)-1 {
+		return schema.GroupVersionKind{}, fmt.Errorf("invalid kind %q, want apiVersion/Kind", s)
+	}
+	gv, err := schema.ParseGroupVersion(s[:i])
+	if err != nil {
+		return schema.GroupVersionKind{}, fmt.Errorf("invalid kind %q: %w", s, err)
+	}
+
+	return gv.WithKind(s[i+1:]), nil
+}
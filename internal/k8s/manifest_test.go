@@ -0,0 +1,148 @@
+package k8s
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestDecode(t *testing.T) {
+	manifest := []byte(`
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: foo123
+---
+# Empty documents are skipped
+---
+{"apiVersion": "v1", "kind": "ResourceQuota", "metadata": {"name": "compute-resources", "namespace": "foo123"}}
+`)
+
+	objs, err := Decode(manifest)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	var got []string
+	for _, obj := range objs {
+		got = append(got, describe(obj))
+	}
+	want := []string{"Namespace foo123", "ResourceQuota compute-resources"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Decode() = %v, want %v", got, want)
+	}
+
+	if _, err := Decode([]byte("kind: [")); err == nil {
+		t.Errorf("Decode() of invalid YAML did not fail")
+	}
+}
+
+func TestValidateObject(t *testing.T) {
+	networkPolicy := []schema.GroupVersionKind{{Group: "networking.k8s.io", Version: "v1", Kind: "NetworkPolicy"}}
+
+	tests := []struct {
+		name     string
+		manifest string
+		allowed  []schema.GroupVersionKind
+		wantErr  bool
+	}{
+		{
+			name:     "User namespace",
+			manifest: "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: foo123\n",
+		},
+		{
+			name:     "Other namespace",
+			manifest: "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: kube-system\n",
+			wantErr:  true,
+		},
+		{
+			name:     "Object in user namespace",
+			manifest: "apiVersion: v1\nkind: PersistentVolumeClaim\nmetadata:\n  name: storage\n  namespace: foo123\nspec:\n  resources:\n    requests:\n      storage: 10Gi\n",
+		},
+		{
+			name:     "Object without namespace",
+			manifest: "apiVersion: v1\nkind: PersistentVolumeClaim\nmetadata:\n  name: storage\n",
+		},
+		{
+			name:     "Object in other namespace",
+			manifest: "apiVersion: v1\nkind: PersistentVolumeClaim\nmetadata:\n  name: storage\n  namespace: bar123\n",
+			wantErr:  true,
+		},
+		{
+			name:     "Unsupported kind",
+			manifest: "apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRoleBinding\nmetadata:\n  name: admin\n",
+			wantErr:  true,
+		},
+		{
+			name:     "Allowed kind",
+			manifest: "apiVersion: networking.k8s.io/v1\nkind: NetworkPolicy\nmetadata:\n  name: deny-all\n",
+			allowed:  networkPolicy,
+		},
+		{
+			name:     "Allowed kind in other namespace",
+			manifest: "apiVersion: networking.k8s.io/v1\nkind: NetworkPolicy\nmetadata:\n  name: deny-all\n  namespace: kube-system\n",
+			allowed:  networkPolicy,
+			wantErr:  true,
+		},
+		{
+			name:     "Kind not allowed",
+			manifest: "apiVersion: networking.k8s.io/v1\nkind: NetworkPolicy\nmetadata:\n  name: deny-all\n",
+			wantErr:  true,
+		},
+		{
+			name:     "Wrong API version",
+			manifest: "apiVersion: apps/v1beta1\nkind: Deployment\nmetadata:\n  name: storage-proxy\n",
+			wantErr:  true,
+		},
+		{
+			name:     "Missing name",
+			manifest: "apiVersion: v1\nkind: Service\nmetadata:\n  namespace: foo123\n",
+			wantErr:  true,
+		},
+		{
+			name:     "Unknown field",
+			manifest: "apiVersion: v1\nkind: ResourceQuota\nmetadata:\n  name: compute-resources\nspec:\n  hrad:\n    requests.cpu: 4\n",
+			wantErr:  true,
+		},
+		{
+			name:     "Invalid quantity",
+			manifest: "apiVersion: v1\nkind: ResourceQuota\nmetadata:\n  name: compute-resources\nspec:\n  hard:\n    requests.memory: 32 GiB\n",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs, err := Decode([]byte(tt.manifest))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ValidateObject("foo123", objs[0], tt.allowed); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateObject() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseKind(t *testing.T) {
+	tests := []struct {
+		kind    string
+		want    schema.GroupVersionKind
+		wantErr bool
+	}{
+		{kind: "networking.k8s.io/v1/NetworkPolicy", want: schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "NetworkPolicy"}},
+		{kind: "v1/ConfigMap", want: schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}},
+		{kind: "NetworkPolicy", wantErr: true},
+		{kind: "networking.k8s.io/v1/", wantErr: true},
+		{kind: "a/b/c/Kind", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			got, err := ParseKind(tt.kind)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKind() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseKind() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
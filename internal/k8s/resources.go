@@ -7,16 +7,24 @@ import (
 
 	"github.com/openlyinc/pointy"
 	"github.com/uitml/quimby/internal/resource"
+	"golang.org/x/sync/errgroup"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
-	ResourceRequestsGPU corev1.ResourceName = "requests.nvidia.com/gpu"
-	ResourceGPU         corev1.ResourceName = "nvidia.com/gpu"
+	// Set on GPU nodes by the NVIDIA GPU feature discovery
+	LabelGPUProduct string = "nvidia.com/gpu.product"
+
+	// GPU products a user may use, comma separated, as rendered from the gpumodels of the spec
+	AnnotationGPUModels string = "springfield.uit.no/gpu-models"
 )
 
+// Quota of the GPUs given by the gpu fields of a spec
+var requestsGPU = resource.Requests(resource.ResourceGPU)
+
 func resourceAsInt64(resources corev1.ResourceList, names ...corev1.ResourceName) (map[corev1.ResourceName]int64, error) {
 	result := make(map[corev1.ResourceName]int64)
 
@@ -43,23 +51,45 @@ func resourceAsInt64(resources corev1.ResourceList, names ...corev1.ResourceName
 	return result, nil
 }
 
-func (c *Client) Quota(namespace string) (resource.Quota, error) {
+// Returns the quantities of the resources in names, which must all exist.
+func resourceQuantities(resources corev1.ResourceList, names ...corev1.ResourceName) (map[corev1.ResourceName]apiresource.Quantity, error) {
+	result := make(map[corev1.ResourceName]apiresource.Quantity)
+	for _, name := range names {
+		q, ok := resources[name]
+		if !ok {
+			return nil, fmt.Errorf("resource %v does not exist", name)
+		}
+		result[name] = q
+	}
+
+	return result, nil
+}
+
+func (c *Client) Quota(ctx context.Context, namespace string) (resource.Quota, error) {
 	// Compute
-	res, err := c.Clientset.CoreV1().ResourceQuotas(namespace).Get(context.TODO(), "compute-resources", metav1.GetOptions{})
+	var res *corev1.ResourceQuota
+	err := c.retry(ctx, "getting the quota of "+namespace, Retryable, func() (err error) {
+		res, err = c.Clientset.CoreV1().ResourceQuotas(namespace).Get(ctx, "compute-resources", metav1.GetOptions{})
+		return err
+	})
 	if err != nil {
 		return resource.Quota{}, err
 	}
 
 	// Storage
-	pvc, err := c.Clientset.CoreV1().PersistentVolumeClaims(namespace).Get(context.TODO(), "storage", metav1.GetOptions{})
+	var pvc *corev1.PersistentVolumeClaim
+	err = c.retry(ctx, "getting the storage of "+namespace, Retryable, func() (err error) {
+		pvc, err = c.Clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, "storage", metav1.GetOptions{})
+		return err
+	})
 	if err != nil {
 		return resource.Quota{}, err
 	}
 
 	// Convert all resources to Int64
 	maxResources, err := resourceAsInt64(
-		res.Spec.Hard,
-		ResourceRequestsGPU,
+		withDefault(res.Spec.Hard, requestsGPU),
+		requestsGPU,
 		corev1.ResourceRequestsCPU,
 		corev1.ResourceRequestsMemory,
 	)
@@ -68,8 +98,8 @@ func (c *Client) Quota(namespace string) (resource.Quota, error) {
 	}
 
 	usedResources, err := resourceAsInt64(
-		res.Status.Used,
-		ResourceRequestsGPU,
+		withDefault(res.Status.Used, requestsGPU),
+		requestsGPU,
 		corev1.ResourceRequestsCPU,
 		corev1.ResourceRequestsMemory,
 	)
@@ -87,8 +117,8 @@ func (c *Client) Quota(namespace string) (resource.Quota, error) {
 
 	rq := resource.Quota{
 		GPU: resource.Summary{
-			Max:  maxResources[ResourceRequestsGPU],
-			Used: usedResources[ResourceRequestsGPU],
+			Max:  maxResources[requestsGPU],
+			Used: usedResources[requestsGPU],
 		},
 		CPU: resource.Summary{
 			Max:  maxResources[corev1.ResourceRequestsCPU],
@@ -101,141 +131,263 @@ func (c *Client) Quota(namespace string) (resource.Quota, error) {
 		Storage: storage[corev1.ResourceStorage],
 	}
 
+	for _, name := range c.Accelerators {
+		if rq.Accelerators == nil {
+			rq.Accelerators = make(map[corev1.ResourceName]resource.Summary)
+		}
+		max, used := res.Spec.Hard[resource.Requests(name)], res.Status.Used[resource.Requests(name)]
+		rq.Accelerators[name] = resource.Summary{Max: max.Value(), Used: used.Value()}
+	}
+
 	return rq, nil
 }
 
-func (c *Client) Spec(namespace string) (*resource.Spec, error) {
-	errchan := make(chan error)
+// Spec returns the resource spec of a user, read from the objects of the user namespace.
+func (c *Client) Spec(ctx context.Context, namespace string) (*resource.Spec, error) {
+	spec, _, err := c.VersionedSpec(ctx, namespace)
 
-	// Compute
-	reschan := make(chan *corev1.ResourceQuota)
-	go func() {
-		res, err := c.Clientset.CoreV1().ResourceQuotas(namespace).Get(context.TODO(), "compute-resources", metav1.GetOptions{})
-		if err != nil {
-			errchan <- err
+	return spec, err
+}
+
+// VersionedSpec returns the resource spec of a user, along with the versions of the objects it
+// was read from. The spec may have changed if later versions differ, or the spec read with them.
+func (c *Client) VersionedSpec(ctx context.Context, namespace string) (*resource.Spec, Versions, error) {
+	// The objects are fetched concurrently. The first error cancels the other requests.
+	var (
+		res *corev1.ResourceQuota
+		lim *corev1.LimitRange
+		pvc *corev1.PersistentVolumeClaim
+		dpl *appsv1.Deployment
+		ns  *corev1.Namespace
+	)
+	g, gctx := errgroup.WithContext(ctx)
+	get := func(what string, request func() error) {
+		g.Go(func() error {
+			return c.retry(gctx, "getting the "+what+" of "+namespace, Retryable, request)
+		})
+	}
+	get("quota", func() (err error) {
+		res, err = c.Clientset.CoreV1().ResourceQuotas(namespace).Get(gctx, "compute-resources", metav1.GetOptions{})
+		return err
+	})
+	get("limit range", func() (err error) {
+		lim, err = c.Clientset.CoreV1().LimitRanges(namespace).Get(gctx, "default-resources", metav1.GetOptions{})
+		return err
+	})
+	get("storage", func() (err error) {
+		pvc, err = c.Clientset.CoreV1().PersistentVolumeClaims(namespace).Get(gctx, "storage", metav1.GetOptions{})
+		return err
+	})
+	get("storage proxy", func() (err error) {
+		dpl, err = c.Clientset.AppsV1().Deployments(namespace).Get(gctx, "storage-proxy", metav1.GetOptions{})
+		return err
+	})
+	get("namespace", func() (err error) {
+		ns, err = c.Clientset.CoreV1().Namespaces().Get(gctx, namespace, metav1.GetOptions{})
+		return err
+	})
+	if err := g.Wait(); err != nil {
+		return nil, nil, err
+	}
+	if len(lim.Spec.Limits) == 0 {
+		return nil, nil, fmt.Errorf("limit range default-resources of user %s has no limits", namespace)
+	}
+	if len(dpl.Spec.Template.Spec.Containers) == 0 {
+		return nil, nil, fmt.Errorf("deployment storage-proxy of user %s has no containers", namespace)
+	}
+
+	// The GPU quota is left out for CPU-only users
+	maxResources, err := resourceQuantities(
+		withDefault(res.Spec.Hard, requestsGPU),
+		requestsGPU,
+		corev1.ResourceRequestsCPU,
+		corev1.ResourceRequestsMemory,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defaultLimits, err := resourceQuantities(
+		withDefault(lim.Spec.Limits[0].Default, resource.ResourceGPU),
+		corev1.ResourceCPU,
+		corev1.ResourceMemory,
+		resource.ResourceGPU,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	storage, err := resourceQuantities(
+		pvc.Spec.Resources.Requests,
+		corev1.ResourceStorage,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	proxy, err := resourceQuantities(
+		dpl.Spec.Template.Spec.Containers[0].Resources.Limits,
+		corev1.ResourceCPU,
+		corev1.ResourceMemory,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	proxyrequest, err := resourceQuantities(
+		dpl.Spec.Template.Spec.Containers[0].Resources.Requests,
+		corev1.ResourceCPU,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var models []string
+	if m := ns.Annotations[AnnotationGPUModels]; m != "" {
+		models = strings.Split(m, ",")
+	}
+
+	// Converted to the units of the spec fields, rounding down
+	result := resource.Spec{
+		GPU:                    pointy.Int64(resource.UnitCount.Truncate(maxResources[requestsGPU])),
+		GPUPerJob:              pointy.Int64(resource.UnitCount.Truncate(defaultLimits[resource.ResourceGPU])),
+		DefaultMemoryPerJob:    pointy.Int64(resource.UnitGiB.Truncate(defaultLimits[corev1.ResourceMemory])),
+		CPUPerJob:              pointy.Int64(resource.UnitCores.Truncate(defaultLimits[corev1.ResourceCPU])),
+		StorageProxyCPURequest: pointy.Int64(resource.UnitMillicores.Truncate(proxyrequest[corev1.ResourceCPU])),
+		StorageProxyCPULimit:   pointy.Int64(resource.UnitMillicores.Truncate(proxy[corev1.ResourceCPU])),
+		StorageProxyMemory:     pointy.Int64(resource.UnitMiB.Truncate(proxy[corev1.ResourceMemory])),
+		StorageSize:            pointy.Int64(resource.UnitGiB.Truncate(storage[corev1.ResourceStorage])),
+		Accelerators:           c.accelerators(res.Spec.Hard),
+		GPUModels:              models,
+	}
+
+	setTotals(&result, maxResources[corev1.ResourceRequestsCPU], maxResources[corev1.ResourceRequestsMemory])
+
+	versions := make(Versions)
+	versions.add("Namespace", ns)
+	versions.add("ResourceQuota", res)
+	versions.add("LimitRange", lim)
+	versions.add("PersistentVolumeClaim", pvc)
+	versions.add("Deployment", dpl)
+
+	return &result, versions, nil
+}
+
+// Sets the CPU and memory quotas of spec from the requests.cpu and requests.memory of the
+// ResourceQuota, the inverse of DerivedResources. maxmemoryperjob is the memory per GPU, rounded
+// down, as templates may use it. The totals are only set where the per GPU values, and for the
+// CPU the LimitRange default, do not add up to the quota, e.g. for users without GPUs.
+func setTotals(spec *resource.Spec, cpu apiresource.Quantity, memory apiresource.Quantity) {
+	gpu := *spec.GPU
+	totalMemory := resource.UnitGiB.Truncate(memory)
+	if gpu > 0 {
+		spec.MaxMemoryPerJob = pointy.Int64(totalMemory / gpu)
+	}
+	if totalMemory != spec.TotalMemory() {
+		spec.Memory = pointy.Int64(totalMemory)
+	}
+	if totalCPU := resource.UnitCores.Truncate(cpu); totalCPU != spec.TotalCPU() {
+		spec.CPU = pointy.Int64(totalCPU)
+	}
+}
+
+// Returns the quota of the accelerators of the client in hard, leaving out those without one.
+func (c *Client) accelerators(hard corev1.ResourceList) map[corev1.ResourceName]int64 {
+	var result map[corev1.ResourceName]int64
+	for _, name := range c.Accelerators {
+		q, ok := hard[resource.Requests(name)]
+		if !ok {
+			continue
 		}
-		reschan <- res
-	}()
-
-	// Limits
-	limchan := make(chan *corev1.LimitRange)
-	go func() {
-		lim, err := c.Clientset.CoreV1().LimitRanges(namespace).Get(context.TODO(), "default-resources", metav1.GetOptions{})
-		if err != nil {
-			errchan <- err
+		if result == nil {
+			result = make(map[corev1.ResourceName]int64)
 		}
-		limchan <- lim
-	}()
+		result[name] = resource.UnitDevices.Truncate(q)
+	}
 
-	// Storage
-	pvcchan := make(chan *corev1.PersistentVolumeClaim)
-	go func() {
-		pvc, err := c.Clientset.CoreV1().PersistentVolumeClaims(namespace).Get(context.TODO(), "storage", metav1.GetOptions{})
-		if err != nil {
-			errchan <- err
-		}
-		pvcchan <- pvc
-	}()
-
-	// storage-proxy
-	proxychan := make(chan *appsv1.Deployment)
-	go func() {
-		dpl, err := c.Clientset.AppsV1().Deployments(namespace).Get(context.TODO(), "storage-proxy", metav1.GetOptions{})
-		if err != nil {
-			errchan <- err
+	return result
+}
+
+// Returns a copy of resources where the resources in names default to zero if they are missing.
+func withDefault(resources corev1.ResourceList, names ...corev1.ResourceName) corev1.ResourceList {
+	result := resources.DeepCopy()
+	if result == nil {
+		result = corev1.ResourceList{}
+	}
+	for _, name := range names {
+		if _, ok := result[name]; !ok {
+			result[name] = apiresource.Quantity{}
 		}
-		proxychan <- dpl
-	}()
-
-	var maxResources, defaultLimits, storage, proxy, proxyrequest map[corev1.ResourceName]int64
-	var err error
-	// Receive and convert all resources to Int64
-	for i := 0; i < 4; i++ {
-		select {
-		case res := <-reschan:
-			maxResources, err = resourceAsInt64(
-				res.Spec.Hard,
-				ResourceRequestsGPU,
-				corev1.ResourceRequestsCPU,
-				corev1.ResourceRequestsMemory,
-			)
-			if err != nil {
-				return nil, err
-			}
+	}
 
-			continue
-		case lim := <-limchan:
-			defaultLimits, err = resourceAsInt64(
-				lim.Spec.Limits[0].Default,
-				corev1.ResourceCPU,
-				corev1.ResourceMemory,
-				ResourceGPU,
-			)
-			if err != nil {
-				return nil, err
-			}
+	return result
+}
 
-			continue
-		case pvc := <-pvcchan:
-			storage, err = resourceAsInt64(
-				pvc.Spec.Resources.Requests,
-				corev1.ResourceStorage,
-			)
-			if err != nil {
-				return nil, err
-			}
+// Keys of the values returned by DerivedResources, in display order.
+var (
+	DerivedQuotaGPU    = "compute-resources " + string(requestsGPU)
+	DerivedQuotaCPU    = "compute-resources " + string(corev1.ResourceRequestsCPU)
+	DerivedQuotaMemory = "compute-resources " + string(corev1.ResourceRequestsMemory)
+
+	DerivedResourceKeys = []string{
+		DerivedQuotaGPU,
+		DerivedQuotaCPU,
+		DerivedQuotaMemory,
+		"default-resources " + string(resource.ResourceGPU),
+		"default-resources " + string(corev1.ResourceCPU),
+		"default-resources " + string(corev1.ResourceMemory),
+		"storage " + string(corev1.ResourceStorage),
+		"storage-proxy " + string(corev1.ResourceRequestsCPU),
+		"storage-proxy " + string(corev1.ResourceLimitsCPU),
+		"storage-proxy " + string(corev1.ResourceLimitsMemory),
+	}
+)
 
-			continue
-		case dpl := <-proxychan:
-			proxy, err = resourceAsInt64(
-				dpl.Spec.Template.Spec.Containers[0].Resources.Limits,
-				corev1.ResourceCPU,
-				corev1.ResourceMemory,
-			)
-			if err != nil {
-				return nil, err
-			}
+// Dereferences v, treating nil as zero.
+func value(v *int64) int64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
 
-			proxyrequest, err = resourceAsInt64(
-				dpl.Spec.Template.Spec.Containers[0].Resources.Requests,
-				corev1.ResourceCPU,
-			)
-			if err != nil {
-				return nil, err
-			}
+// DerivedResources returns the Kubernetes resource values a spec translates to, keyed by object
+// and resource name. It is the inverse of the conversion done in Spec.
+func DerivedResources(spec *resource.Spec) map[string]apiresource.Quantity {
+	values := []apiresource.Quantity{
+		*resource.UnitCount.Quantity(value(spec.GPU)),
+		*resource.UnitCores.Quantity(spec.TotalCPU()),
+		*resource.UnitGiB.Quantity(spec.TotalMemory()),
+		*resource.UnitCount.Quantity(value(spec.GPUPerJob)),
+		*resource.UnitCores.Quantity(value(spec.CPUPerJob)),
+		*resource.UnitGiB.Quantity(value(spec.DefaultMemoryPerJob)),
+		*resource.UnitGiB.Quantity(value(spec.StorageSize)),
+		*resource.UnitMillicores.Quantity(value(spec.StorageProxyCPURequest)),
+		*resource.UnitMillicores.Quantity(value(spec.StorageProxyCPULimit)),
+		*resource.UnitMiB.Quantity(value(spec.StorageProxyMemory)),
+	}
 
-			continue
-		case err := <-errchan:
-			close(errchan)
-			return nil, err
-		}
+	result := make(map[string]apiresource.Quantity)
+	for i, key := range DerivedResourceKeys {
+		result[key] = values[i]
 	}
 
-	// This is a hot mess
-	result := resource.Spec{
-		GPU:                    pointy.Int64(maxResources[ResourceRequestsGPU]),
-		GPUPerJob:              pointy.Int64(defaultLimits[ResourceGPU]),
-		MaxMemoryPerJob:        pointy.Int64(maxResources[corev1.ResourceRequestsMemory] / 1024 / 1024 / 1024 / maxResources[ResourceRequestsGPU]), // in GiB
-		DefaultMemoryPerJob:    pointy.Int64(defaultLimits[corev1.ResourceMemory] / 1024 / 1024 / 1024),                                            // in GiB
-		CPUPerJob:              pointy.Int64(defaultLimits[corev1.ResourceCPU] / 1000),                                                             // not milli
-		StorageProxyCPURequest: pointy.Int64(proxyrequest[corev1.ResourceCPU]),                                                                     // milli
-		StorageProxyCPULimit:   pointy.Int64(proxy[corev1.ResourceCPU]),                                                                            // milli
-		StorageProxyMemory:     pointy.Int64(proxy[corev1.ResourceMemory] / 1024 / 1024),                                                           // in MB
-		StorageSize:            pointy.Int64(storage[corev1.ResourceStorage] / 1024 / 1024 / 1024),                                                 // in GiB
-	}
-
-	return &result, nil
+	return result
 }
 
-func (c *Client) DefaultRequest(namespace string) (resource.Request, error) {
-	res, err := c.Clientset.CoreV1().LimitRanges(namespace).List(context.TODO(), metav1.ListOptions{})
+func (c *Client) DefaultRequest(ctx context.Context, namespace string) (resource.Request, error) {
+	var res *corev1.LimitRangeList
+	err := c.retry(ctx, "listing the limit ranges of "+namespace, Retryable, func() (err error) {
+		res, err = c.Clientset.CoreV1().LimitRanges(namespace).List(ctx, metav1.ListOptions{})
+		return err
+	})
 	if err != nil {
 		return resource.Request{}, err
 	}
 
 	limits, err := resourceAsInt64(
 		res.Items[0].Spec.Limits[0].DefaultRequest,
-		ResourceGPU,
+		resource.ResourceGPU,
 		corev1.ResourceCPU,
 		corev1.ResourceRequestsMemory,
 	)
@@ -244,7 +396,7 @@ func (c *Client) DefaultRequest(namespace string) (resource.Request, error) {
 	}
 
 	rr := resource.Request{
-		GPU:    limits[ResourceGPU],
+		GPU:    limits[resource.ResourceGPU],
 		CPU:    limits[corev1.ResourceCPU],
 		Memory: limits[corev1.ResourceMemory],
 	}
@@ -252,38 +404,86 @@ func (c *Client) DefaultRequest(namespace string) (resource.Request, error) {
 	return rr, nil
 }
 
-func (c *Client) TotalGPUs() (resource.Summary, error) {
-	var totalGPUs int64 = 0
-	// TODO: Find out how to get used GPUs from node info. Haven't found it yet, so now it's being counted from the user info.
-	var usedGPUs int64 = 0
+// TotalGPUs returns the capacity of the schedulable nodes of nvidia.com/gpu and each of the
+// accelerators of the client, and of nvidia.com/gpu by GPU product.
+func (c *Client) TotalGPUs(ctx context.Context) (resource.Capacity, error) {
+	names := append([]corev1.ResourceName{resource.ResourceGPU}, c.Accelerators...)
+	capacity := resource.Capacity{
+		Resources: make(map[corev1.ResourceName]resource.Summary),
+		GPUModels: make(map[string]int64),
+	}
+	for _, name := range names {
+		capacity.Resources[name] = resource.Summary{}
+	}
 
-	nodes, err := c.Clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	nodes, err := c.nodes(ctx)
 	if err != nil {
-		return resource.Summary{}, err
+		return resource.Capacity{}, err
 	}
 
 	for _, node := range nodes.Items {
-		var nodeReady bool = true
-		for _, condition := range node.Status.Conditions {
-			if condition.Type != corev1.NodeReady {
-				continue
-			}
+		if !schedulable(node) {
+			continue
+		}
+
+		for _, name := range names {
+			// TODO: Find out how to get used GPUs from node info. Haven't found it yet, so now it's being counted from the user info.
+			q := node.Status.Capacity[name]
+			t := capacity.Resources[name]
+			t.Max += q.Value()
+			capacity.Resources[name] = t
+		}
+		if gpus := node.Status.Capacity[resource.ResourceGPU]; !gpus.IsZero() {
+			capacity.GPUModels[node.Labels[LabelGPUProduct]] += gpus.Value()
+		}
+	}
+
+	return capacity, nil
+}
+
+// Returns all nodes of the cluster.
+func (c *Client) nodes(ctx context.Context) (nodes *corev1.NodeList, err error) {
+	err = c.retry(ctx, "listing nodes", Retryable, func() error {
+		nodes, err = c.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		return err
+	})
+
+	return nodes, err
+}
+
+// Returns true if node is ready and schedulable.
+func schedulable(node corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
 			if condition.Status != corev1.ConditionTrue {
-				nodeReady = false
+				return false
 			}
 			break
 		}
-		if !nodeReady {
-			continue
-		}
-		if node.Spec.Unschedulable {
+	}
+
+	return !node.Spec.Unschedulable
+}
+
+// Cluster returns facts about the schedulable nodes of the cluster.
+func (c *Client) Cluster(ctx context.Context) (resource.Cluster, error) {
+	nodes, err := c.nodes(ctx)
+	if err != nil {
+		return resource.Cluster{}, err
+	}
+
+	cluster := resource.Cluster{}
+	for _, node := range nodes.Items {
+		if !schedulable(node) {
 			continue
 		}
-
 		// Ignoring errors here since some nodes might not have all resources
-		g, _ := resourceAsInt64(node.Status.Capacity, ResourceGPU)
-		totalGPUs += g[ResourceGPU]
+		g, _ := resourceAsInt64(node.Status.Allocatable, resource.ResourceGPU)
+		if g[resource.ResourceGPU] > cluster.MaxNodeGPUs {
+			cluster.MaxNodeGPUs = g[resource.ResourceGPU]
+			cluster.GPUProduct = node.Labels[LabelGPUProduct]
+		}
 	}
 
-	return resource.Summary{Max: totalGPUs, Used: usedGPUs}, nil
+	return cluster, nil
 }
@@ -1,12 +1,18 @@
 package k8s
 
 import (
+	"context"
 	"reflect"
+	"strconv"
 	"testing"
 
+	"github.com/openlyinc/pointy"
 	internalfake "github.com/uitml/quimby/internal/fake"
 	"github.com/uitml/quimby/internal/resource"
 	corev1 "k8s.io/api/core/v1"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 )
@@ -34,13 +40,13 @@ func Test_resourceAsInt64(t *testing.T) {
 					2,        // inverse scaling
 				).Status.Hard,
 				names: []corev1.ResourceName{
-					ResourceRequestsGPU,
+					requestsGPU,
 					corev1.ResourceRequestsCPU,
 					corev1.ResourceRequestsMemory,
 				},
 			},
 			want: map[corev1.ResourceName]int64{
-				ResourceRequestsGPU:           2,
+				requestsGPU:                   2,
 				corev1.ResourceRequestsCPU:    4500,
 				corev1.ResourceRequestsMemory: (16*1024 + 256) * 1024 * 1024, // bytes
 			},
@@ -58,7 +64,7 @@ func Test_resourceAsInt64(t *testing.T) {
 					2,        // inverse scaling
 				).Status.Hard,
 				names: []corev1.ResourceName{
-					ResourceRequestsGPU,
+					requestsGPU,
 					"foo",
 					corev1.ResourceRequestsMemory,
 				},
@@ -130,7 +136,7 @@ func TestClient_Quota(t *testing.T) {
 			c := &Client{
 				Clientset: tt.fields.Clientset,
 			}
-			got, err := c.Quota(tt.args.namespace)
+			got, err := c.Quota(context.Background(), tt.args.namespace)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Client.Quota() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -142,55 +148,420 @@ func TestClient_Quota(t *testing.T) {
 	}
 }
 
+// Returns the objects of a user read by Client.Spec, with the quota in hard.
+func specObjects(namespace string, annotations map[string]string, hard corev1.ResourceList, defaults corev1.ResourceList) []runtime.Object {
+	return []runtime.Object{
+		NewNamespace(namespace, nil, annotations),
+		&corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "compute-resources", Namespace: namespace},
+			Spec:       corev1.ResourceQuotaSpec{Hard: hard},
+		},
+		internalfake.NewLimitRange(namespace, defaults),
+		internalfake.NewPVC(namespace, 100),
+		internalfake.NewStorageProxy(namespace,
+			corev1.ResourceList{corev1.ResourceCPU: apiresource.MustParse("100m")},
+			corev1.ResourceList{corev1.ResourceCPU: apiresource.MustParse("500m"), corev1.ResourceMemory: apiresource.MustParse("256Mi")},
+		),
+	}
+}
+
+func TestClient_Spec(t *testing.T) {
+	proxy := resource.Spec{
+		StorageProxyCPURequest: pointy.Int64(100),
+		StorageProxyCPULimit:   pointy.Int64(500),
+		StorageProxyMemory:     pointy.Int64(256),
+		StorageSize:            pointy.Int64(100),
+	}
+	with := func(s resource.Spec) *resource.Spec {
+		s.StorageProxyCPURequest, s.StorageProxyCPULimit = proxy.StorageProxyCPURequest, proxy.StorageProxyCPULimit
+		s.StorageProxyMemory, s.StorageSize = proxy.StorageProxyMemory, proxy.StorageSize
+		return &s
+	}
+
+	mig := corev1.ResourceName("nvidia.com/mig-1g.10gb")
+	tests := []struct {
+		name         string
+		annotations  map[string]string
+		hard         corev1.ResourceList
+		defaults     corev1.ResourceList
+		accelerators []corev1.ResourceName
+		want         *resource.Spec
+	}{
+		{
+			name: "Quota per GPU",
+			hard: corev1.ResourceList{
+				requestsGPU:                   apiresource.MustParse("2"),
+				corev1.ResourceRequestsCPU:    apiresource.MustParse("8100m"),
+				corev1.ResourceRequestsMemory: apiresource.MustParse("65792Mi"),
+			},
+			defaults: corev1.ResourceList{
+				resource.ResourceGPU:  apiresource.MustParse("1"),
+				corev1.ResourceCPU:    apiresource.MustParse("4"),
+				corev1.ResourceMemory: apiresource.MustParse("8Gi"),
+			},
+			want: with(resource.Spec{
+				GPU: pointy.Int64(2), GPUPerJob: pointy.Int64(1), MaxMemoryPerJob: pointy.Int64(32),
+				DefaultMemoryPerJob: pointy.Int64(8), CPUPerJob: pointy.Int64(4),
+			}),
+		},
+		{
+			name: "Quota not a multiple of the GPUs",
+			hard: corev1.ResourceList{
+				requestsGPU:                   apiresource.MustParse("2"),
+				corev1.ResourceRequestsCPU:    apiresource.MustParse("10100m"),
+				corev1.ResourceRequestsMemory: apiresource.MustParse("50432Mi"),
+			},
+			defaults: corev1.ResourceList{
+				resource.ResourceGPU:  apiresource.MustParse("1"),
+				corev1.ResourceCPU:    apiresource.MustParse("4"),
+				corev1.ResourceMemory: apiresource.MustParse("8Gi"),
+			},
+			want: with(resource.Spec{
+				GPU: pointy.Int64(2), GPUPerJob: pointy.Int64(1), MaxMemoryPerJob: pointy.Int64(24), Memory: pointy.Int64(49),
+				CPU: pointy.Int64(10), DefaultMemoryPerJob: pointy.Int64(8), CPUPerJob: pointy.Int64(4),
+			}),
+		},
+		{
+			// The quota of the jobs only, without the storage-proxy on top
+			name: "Quota without the storage-proxy",
+			hard: corev1.ResourceList{
+				requestsGPU:                   apiresource.MustParse("2"),
+				corev1.ResourceRequestsCPU:    apiresource.MustParse("8"),
+				corev1.ResourceRequestsMemory: apiresource.MustParse("64Gi"),
+			},
+			defaults: corev1.ResourceList{
+				resource.ResourceGPU:  apiresource.MustParse("1"),
+				corev1.ResourceCPU:    apiresource.MustParse("4"),
+				corev1.ResourceMemory: apiresource.MustParse("8Gi"),
+			},
+			want: with(resource.Spec{
+				GPU: pointy.Int64(2), GPUPerJob: pointy.Int64(1), MaxMemoryPerJob: pointy.Int64(32),
+				DefaultMemoryPerJob: pointy.Int64(8), CPUPerJob: pointy.Int64(4),
+			}),
+		},
+		{
+			name: "Storage-proxy on the memory only",
+			hard: corev1.ResourceList{
+				requestsGPU:                   apiresource.MustParse("2"),
+				corev1.ResourceRequestsCPU:    apiresource.MustParse("8"),
+				corev1.ResourceRequestsMemory: apiresource.MustParse("65792Mi"),
+			},
+			defaults: corev1.ResourceList{
+				resource.ResourceGPU:  apiresource.MustParse("1"),
+				corev1.ResourceCPU:    apiresource.MustParse("4"),
+				corev1.ResourceMemory: apiresource.MustParse("8Gi"),
+			},
+			want: with(resource.Spec{
+				GPU: pointy.Int64(2), GPUPerJob: pointy.Int64(1), MaxMemoryPerJob: pointy.Int64(32),
+				DefaultMemoryPerJob: pointy.Int64(8), CPUPerJob: pointy.Int64(4),
+			}),
+		},
+		{
+			name: "Accelerators of the client",
+			hard: corev1.ResourceList{
+				requestsGPU:                   apiresource.MustParse("2"),
+				resource.Requests(mig):        apiresource.MustParse("7"),
+				"requests.nvidia.com/other":   apiresource.MustParse("1"),
+				corev1.ResourceRequestsCPU:    apiresource.MustParse("8100m"),
+				corev1.ResourceRequestsMemory: apiresource.MustParse("65792Mi"),
+			},
+			defaults: corev1.ResourceList{
+				resource.ResourceGPU:  apiresource.MustParse("1"),
+				corev1.ResourceCPU:    apiresource.MustParse("4"),
+				corev1.ResourceMemory: apiresource.MustParse("8Gi"),
+			},
+			accelerators: []corev1.ResourceName{mig, "nvidia.com/mig-2g.20gb"},
+			want: with(resource.Spec{
+				GPU: pointy.Int64(2), GPUPerJob: pointy.Int64(1), MaxMemoryPerJob: pointy.Int64(32),
+				DefaultMemoryPerJob: pointy.Int64(8), CPUPerJob: pointy.Int64(4),
+				Accelerators: map[corev1.ResourceName]int64{mig: 7},
+			}),
+		},
+		{
+			name:        "GPU models",
+			annotations: map[string]string{AnnotationGPUModels: "NVIDIA-A100-SXM4-40GB,Tesla-V100-PCIE-32GB"},
+			hard: corev1.ResourceList{
+				requestsGPU:                   apiresource.MustParse("2"),
+				corev1.ResourceRequestsCPU:    apiresource.MustParse("8100m"),
+				corev1.ResourceRequestsMemory: apiresource.MustParse("65792Mi"),
+			},
+			defaults: corev1.ResourceList{
+				resource.ResourceGPU:  apiresource.MustParse("1"),
+				corev1.ResourceCPU:    apiresource.MustParse("4"),
+				corev1.ResourceMemory: apiresource.MustParse("8Gi"),
+			},
+			want: with(resource.Spec{
+				GPU: pointy.Int64(2), GPUPerJob: pointy.Int64(1), MaxMemoryPerJob: pointy.Int64(32),
+				DefaultMemoryPerJob: pointy.Int64(8), CPUPerJob: pointy.Int64(4),
+				GPUModels: []string{"NVIDIA-A100-SXM4-40GB", "Tesla-V100-PCIE-32GB"},
+			}),
+		},
+		{
+			name: "CPU-only user without GPU resources",
+			hard: corev1.ResourceList{
+				corev1.ResourceRequestsCPU:    apiresource.MustParse("16100m"),
+				corev1.ResourceRequestsMemory: apiresource.MustParse("65792Mi"),
+			},
+			defaults: corev1.ResourceList{
+				corev1.ResourceCPU:    apiresource.MustParse("2"),
+				corev1.ResourceMemory: apiresource.MustParse("8Gi"),
+			},
+			want: with(resource.Spec{
+				GPU: pointy.Int64(0), GPUPerJob: pointy.Int64(0), Memory: pointy.Int64(64), CPU: pointy.Int64(16),
+				DefaultMemoryPerJob: pointy.Int64(8), CPUPerJob: pointy.Int64(2),
+			}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{
+				Clientset:    fake.NewSimpleClientset(specObjects("foo123", tt.annotations, tt.hard, tt.defaults)...),
+				Accelerators: tt.accelerators,
+			}
+			got, err := c.Spec(context.Background(), "foo123")
+			if err != nil {
+				t.Fatalf("Client.Spec() error = %v", err)
+			}
+			if diff := resource.DiffSpec(tt.want, got); len(diff) > 0 {
+				t.Errorf("Client.Spec() differs from want: %v", diff)
+			}
+			if got.TotalMemory() != tt.want.TotalMemory() || got.TotalCPU() != tt.want.TotalCPU() {
+				t.Errorf("Client.Spec() totals = %d GiB, %d cores, want %d GiB, %d cores",
+					got.TotalMemory(), got.TotalCPU(), tt.want.TotalMemory(), tt.want.TotalCPU())
+			}
+		})
+	}
+}
+
+func TestClient_Spec_missing(t *testing.T) {
+	hard := corev1.ResourceList{
+		corev1.ResourceRequestsCPU:    apiresource.MustParse("16100m"),
+		corev1.ResourceRequestsMemory: apiresource.MustParse("65792Mi"),
+	}
+	defaults := corev1.ResourceList{
+		corev1.ResourceCPU:    apiresource.MustParse("2"),
+		corev1.ResourceMemory: apiresource.MustParse("8Gi"),
+	}
+	objects := specObjects("foo123", nil, hard, defaults)
+	for i := range objects {
+		// Leave out one object at a time, each must fail without blocking the others
+		var partial []runtime.Object
+		partial = append(partial, objects[:i]...)
+		partial = append(partial, objects[i+1:]...)
+		c := &Client{Clientset: fake.NewSimpleClientset(partial...)}
+		if _, err := c.Spec(context.Background(), "foo123"); err == nil {
+			t.Errorf("Client.Spec() without object %d error = nil, want error", i)
+		}
+	}
+}
+
 func TestClient_TotalGPUs(t *testing.T) {
 	type fields struct {
-		Clientset kubernetes.Interface
+		Clientset    kubernetes.Interface
+		Accelerators []corev1.ResourceName
 	}
+	mig := corev1.ResourceName("nvidia.com/mig-1g.10gb")
+	gpus := func(max int64) resource.Capacity {
+		c := resource.Capacity{
+			Resources: map[corev1.ResourceName]resource.Summary{resource.ResourceGPU: {Max: max}},
+			GPUModels: map[string]int64{},
+		}
+		if max > 0 {
+			c.GPUModels[""] = max
+		}
+		return c
+	}
+	a100, v100 := "NVIDIA-A100-SXM4-40GB", "Tesla-V100-PCIE-32GB"
 	tests := []struct {
 		name    string
 		fields  fields
-		want    resource.Summary
+		want    resource.Capacity
 		wantErr bool
 	}{
 		// Testcase 1: Empty node list. Should return zero
 		{
 			name:    "No nodes",
-			fields:  fields{fake.NewSimpleClientset()},
-			want:    resource.Summary{Max: 0, Used: 0},
+			fields:  fields{Clientset: fake.NewSimpleClientset()},
+			want:    gpus(0),
 			wantErr: false,
 		},
 		// Testcase 2: 3 servers, 2 with GPUs
 		{
 			name: "3 srv, 2 with GPU",
-			fields: fields{fake.NewSimpleClientset(
+			fields: fields{Clientset: fake.NewSimpleClientset(
 				internalfake.NewNodeList([]string{"foo", "bar", "baz"}, []int64{0, 8, 7}, []bool{false, false, false}),
 			)},
-			want:    resource.Summary{Max: 15, Used: 0},
+			want:    gpus(15),
 			wantErr: false,
 		},
 		// Testcase 3: 3 servers, 2 with GPUs, but one is unschedulable
 		{
 			name: "3 srv, 2 with gpu, one unschedulable",
-			fields: fields{fake.NewSimpleClientset(
+			fields: fields{Clientset: fake.NewSimpleClientset(
 				internalfake.NewNodeList([]string{"foo", "bar", "baz"}, []int64{0, 8, 7}, []bool{false, false, true}),
 			)},
-			want:    resource.Summary{Max: 8, Used: 0},
+			want:    gpus(8),
+			wantErr: false,
+		},
+		// Testcase 4: MIG slices are counted separately from whole GPUs
+		{
+			name: "GPUs and MIG slices",
+			fields: fields{
+				Clientset: fake.NewSimpleClientset(
+					internalfake.NewAcceleratorNode("foo", map[corev1.ResourceName]int64{resource.ResourceGPU: 4, mig: 7}),
+					internalfake.NewAcceleratorNode("bar", map[corev1.ResourceName]int64{mig: 14}),
+				),
+				Accelerators: []corev1.ResourceName{mig},
+			},
+			want: resource.Capacity{
+				Resources: map[corev1.ResourceName]resource.Summary{resource.ResourceGPU: {Max: 4}, mig: {Max: 21}},
+				GPUModels: map[string]int64{"": 4},
+			},
+			wantErr: false,
+		},
+		// Testcase 5: GPUs by the product label of the nodes
+		{
+			name: "GPU models",
+			fields: fields{Clientset: fake.NewSimpleClientset(
+				internalfake.NewGPUNode("foo", 8, a100),
+				internalfake.NewGPUNode("bar", 4, v100),
+				internalfake.NewGPUNode("baz", 8, a100),
+			)},
+			want: resource.Capacity{
+				Resources: map[corev1.ResourceName]resource.Summary{resource.ResourceGPU: {Max: 20}},
+				GPUModels: map[string]int64{a100: 16, v100: 4},
+			},
 			wantErr: false,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			c := &Client{
-				Clientset: tt.fields.Clientset,
+				Clientset:    tt.fields.Clientset,
+				Accelerators: tt.fields.Accelerators,
 			}
-			got, err := c.TotalGPUs()
+			got, err := c.TotalGPUs(context.Background())
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Client.TotalGPUs() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if got != tt.want {
+			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Client.TotalGPUs() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestClient_Cluster(t *testing.T) {
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		want    resource.Cluster
+	}{
+		{
+			name: "No nodes",
+			want: resource.Cluster{},
+		},
+		{
+			name: "Largest node",
+			objects: []runtime.Object{
+				internalfake.NewGPUNode("foo", 4, "Tesla-V100-SXM2-32GB"),
+				internalfake.NewGPUNode("bar", 8, "NVIDIA-A100-SXM4-40GB"),
+				internalfake.NewGPUNode("baz", 2, "Tesla-P100-PCIE-16GB"),
+			},
+			want: resource.Cluster{MaxNodeGPUs: 8, GPUProduct: "NVIDIA-A100-SXM4-40GB"},
+		},
+		{
+			name: "Unschedulable nodes are ignored",
+			objects: []runtime.Object{
+				internalfake.NewGPUNode("foo", 4, "Tesla-V100-SXM2-32GB"),
+				internalfake.NewNodeList([]string{"bar"}, []int64{8}, []bool{true}),
+			},
+			want: resource.Cluster{MaxNodeGPUs: 4, GPUProduct: "Tesla-V100-SXM2-32GB"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{Clientset: fake.NewSimpleClientset(tt.objects...)}
+			got, err := c.Cluster(context.Background())
+			if err != nil {
+				t.Fatalf("Client.Cluster() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Client.Cluster() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDerivedResources(t *testing.T) {
+	spec := &resource.Spec{
+		GPU:                    pointy.Int64(2),
+		GPUPerJob:              pointy.Int64(1),
+		MaxMemoryPerJob:        pointy.Int64(16),
+		DefaultMemoryPerJob:    pointy.Int64(12),
+		CPUPerJob:              pointy.Int64(2),
+		StorageProxyCPURequest: pointy.Int64(200),
+		StorageProxyCPULimit:   pointy.Int64(500),
+		StorageProxyMemory:     pointy.Int64(256),
+		StorageSize:            pointy.Int64(500),
+	}
+	want := []string{"2", "4", "32Gi", "1", "2", "12Gi", "500Gi", "200m", "500m", "256Mi"}
+
+	got := DerivedResources(spec)
+	if len(got) != len(DerivedResourceKeys) {
+		t.Fatalf("DerivedResources() returned %d values, want %d", len(got), len(DerivedResourceKeys))
+	}
+	for i, key := range DerivedResourceKeys {
+		q := got[key]
+		if q.String() != want[i] {
+			t.Errorf("DerivedResources()[%q] = %v, want %v", key, q.String(), want[i])
+		}
+	}
+}
+
+func TestDerivedResources_Spec(t *testing.T) {
+	proxy := func(s resource.Spec) *resource.Spec {
+		s.StorageProxyCPURequest, s.StorageProxyCPULimit = pointy.Int64(100), pointy.Int64(500)
+		s.StorageProxyMemory, s.StorageSize = pointy.Int64(256), pointy.Int64(100)
+		return &s
+	}
+	specs := map[string]*resource.Spec{
+		"Per GPU": proxy(resource.Spec{
+			GPU: pointy.Int64(2), GPUPerJob: pointy.Int64(1), MaxMemoryPerJob: pointy.Int64(32),
+			DefaultMemoryPerJob: pointy.Int64(8), CPUPerJob: pointy.Int64(4),
+		}),
+		"Totals": proxy(resource.Spec{
+			GPU: pointy.Int64(2), GPUPerJob: pointy.Int64(1), MaxMemoryPerJob: pointy.Int64(24), Memory: pointy.Int64(49),
+			CPU: pointy.Int64(10), DefaultMemoryPerJob: pointy.Int64(8), CPUPerJob: pointy.Int64(4),
+		}),
+		"CPU-only": proxy(resource.Spec{
+			GPU: pointy.Int64(0), GPUPerJob: pointy.Int64(0), Memory: pointy.Int64(64), CPU: pointy.Int64(16),
+			DefaultMemoryPerJob: pointy.Int64(8), CPUPerJob: pointy.Int64(2),
+		}),
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			// The spec must read back unchanged from the resources it translates to
+			derived := DerivedResources(spec)
+			hard := corev1.ResourceList{
+				requestsGPU:                   derived[DerivedQuotaGPU],
+				corev1.ResourceRequestsCPU:    derived[DerivedQuotaCPU],
+				corev1.ResourceRequestsMemory: derived[DerivedQuotaMemory],
+			}
+			defaults := corev1.ResourceList{
+				resource.ResourceGPU:  apiresource.MustParse(strconv.FormatInt(*spec.GPUPerJob, 10)),
+				corev1.ResourceCPU:    apiresource.MustParse(strconv.FormatInt(*spec.CPUPerJob, 10)),
+				corev1.ResourceMemory: apiresource.MustParse(strconv.FormatInt(*spec.DefaultMemoryPerJob, 10) + "Gi"),
+			}
+			c := &Client{Clientset: fake.NewSimpleClientset(specObjects("foo123", nil, hard, defaults)...)}
+			got, err := c.Spec(context.Background(), "foo123")
+			if err != nil {
+				t.Fatalf("Client.Spec() error = %v", err)
+			}
+			if diff := resource.DiffSpec(spec, got); len(diff) > 0 {
+				t.Errorf("Client.Spec() of DerivedResources() differs: %v", diff)
+			}
+		})
+	}
+}
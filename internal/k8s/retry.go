@@ -0,0 +1,81 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// DefaultBackoff is used for requests that fail with a transient error, unless the client has a
+// backoff of its own: up to five attempts, waiting about 0.5, 1, 2 and 4 seconds in between.
+var DefaultBackoff = wait.Backoff{Steps: 5, Duration: 500 * time.Millisecond, Factor: 2, Jitter: 0.1}
+
+// Retryable returns true if err is transient, so that the same request may succeed if sent
+// again: throttling, internal errors, an unavailable API server, and timeouts.
+func Retryable(err error) bool {
+	switch {
+	case apierrors.IsTooManyRequests(err),
+		apierrors.IsInternalError(err),
+		apierrors.IsServiceUnavailable(err),
+		apierrors.IsServerTimeout(err),
+		apierrors.IsTimeout(err),
+		utilnet.IsConnectionReset(err):
+		return true
+	}
+
+	// Timeouts of the connection, but not of the context of the request
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Returns true if err is Retryable, or a conflict other than on the ownership of fields, e.g. an
+// object that was changed by someone else while being applied. Field manager conflicts are not
+// retried, as applying the same fields again conflicts again.
+func retryableApply(err error) bool {
+	if Retryable(err) {
+		return true
+	}
+
+	return apierrors.IsConflict(err) && len(conflicts(err)) == 0
+}
+
+// Calls request until it succeeds, fails with an error retryable does not accept, the backoff of
+// the client is exhausted or ctx is done. Returns the last error of request. Each retry is
+// logged at verbose level, with what describing the request.
+func (c *Client) retry(ctx context.Context, what string, retryable func(error) bool, request func() error) error {
+	backoff := c.Backoff
+	if backoff.Steps == 0 {
+		backoff = DefaultBackoff
+	}
+
+	for {
+		err := request()
+		if err == nil || !retryable(err) || ctx.Err() != nil || backoff.Steps <= 1 {
+			return err
+		}
+
+		delay := backoff.Step()
+		c.logf("%s failed, retrying in %s: %v", what, delay.Round(time.Millisecond), err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// Logs a message if the client is verbose.
+func (c *Client) logf(format string, args ...interface{}) {
+	if c.Logf != nil {
+		c.Logf(format, args...)
+	}
+}
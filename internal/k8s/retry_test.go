@@ -0,0 +1,101 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestRetryable(t *testing.T) {
+	gr := schema.GroupResource{Resource: "namespaces"}
+	fieldConflict := apierrors.NewApplyConflict([]metav1.StatusCause{
+		{Type: metav1.CauseTypeFieldManagerConflict, Message: `conflict with "kubectl"`, Field: ".metadata.labels"},
+	}, "Apply failed with 1 conflict")
+
+	tests := []struct {
+		name      string
+		err       error
+		want      bool
+		wantApply bool
+	}{
+		{"Too many requests", apierrors.NewTooManyRequests("slow down", 1), true, true},
+		{"Internal error", apierrors.NewInternalError(errors.New("boom")), true, true},
+		{"Service unavailable", apierrors.NewServiceUnavailable("unavailable"), true, true},
+		{"Server timeout", apierrors.NewServerTimeout(gr, "get", 1), true, true},
+		{"Timeout", apierrors.NewTimeoutError("timeout", 1), true, true},
+		{"Not found", apierrors.NewNotFound(gr, "foo123"), false, false},
+		{"Forbidden", apierrors.NewForbidden(gr, "foo123", errors.New("no")), false, false},
+		{"Conflict", apierrors.NewConflict(gr, "foo123", errors.New("changed")), false, true},
+		{"Field manager conflict", fieldConflict, false, false},
+		{"Context deadline", context.DeadlineExceeded, false, false},
+		{"Nil", nil, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Retryable(tt.err); got != tt.want {
+				t.Errorf("Retryable() = %v, want %v", got, tt.want)
+			}
+			if got := retryableApply(tt.err); got != tt.wantApply {
+				t.Errorf("retryableApply() = %v, want %v", got, tt.wantApply)
+			}
+		})
+	}
+}
+
+func TestClient_retry(t *testing.T) {
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "templates", Namespace: "quimby-system"}}
+	unavailable := apierrors.NewServiceUnavailable("unavailable")
+
+	tests := []struct {
+		name      string
+		failures  int   // requests that fail before the first success
+		err       error // error of the failures
+		wantCalls int
+		wantErr   bool
+	}{
+		{"Success", 0, nil, 1, false},
+		{"Transient failures", 2, unavailable, 3, false},
+		{"Backoff exhausted", 10, unavailable, 3, true},
+		{"Not retryable", 10, apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "templates"), 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(cm)
+			calls := 0
+			clientset.PrependReactor("get", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+				calls++
+				if calls <= tt.failures {
+					return true, nil, tt.err
+				}
+				return false, nil, nil
+			})
+
+			var logged int
+			c := &Client{
+				Clientset: clientset,
+				Backoff:   wait.Backoff{Steps: 3, Duration: time.Millisecond, Factor: 2},
+				Logf:      func(string, ...interface{}) { logged++ },
+			}
+			_, err := c.ConfigMap(context.Background(), "quimby-system", "templates")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.ConfigMap() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("Client.ConfigMap() made %d requests, want %d", calls, tt.wantCalls)
+			}
+			if logged != calls-1 {
+				t.Errorf("Client.ConfigMap() logged %d retries, want %d", logged, calls-1)
+			}
+		})
+	}
+}
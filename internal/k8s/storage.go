@@ -0,0 +1,107 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Interval between checks on a volume being resized
+var resizePollInterval = 2 * time.Second
+
+// ResizeStorage expands the storage volume of a user to size, and waits until the resize is
+// finished or the timeout expires. Volumes can not be shrunk.
+func (c *Client) ResizeStorage(ctx context.Context, namespace string, size apiresource.Quantity, timeout time.Duration) error {
+	pvcs := c.Clientset.CoreV1().PersistentVolumeClaims(namespace)
+	var pvc *corev1.PersistentVolumeClaim
+	err := c.retry(ctx, "getting the storage of "+namespace, Retryable, func() (err error) {
+		pvc, err = pvcs.Get(ctx, "storage", metav1.GetOptions{})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	current := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	switch size.Cmp(current) {
+	case 0:
+		return nil
+	case -1:
+		return fmt.Errorf("can not shrink the storage of user %s from %s to %s, volumes can only be expanded",
+			namespace, current.String(), size.String())
+	}
+
+	if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" {
+		return fmt.Errorf("storage of user %s has no storage class, and can not be expanded", namespace)
+	}
+	var class *storagev1.StorageClass
+	err = c.retry(ctx, "getting storage class "+*pvc.Spec.StorageClassName, Retryable, func() (err error) {
+		class, err = c.Clientset.StorageV1().StorageClasses().Get(ctx, *pvc.Spec.StorageClassName, metav1.GetOptions{})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if class.AllowVolumeExpansion == nil || !*class.AllowVolumeExpansion {
+		return fmt.Errorf("storage class %s does not allow volume expansion", class.Name)
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"resources": map[string]interface{}{
+				"requests": map[string]string{string(corev1.ResourceStorage): size.String()},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	err = c.retry(ctx, "resizing the storage of "+namespace, Retryable, func() error {
+		_, err := pvcs.Patch(ctx, "storage", types.MergePatchType, patch, metav1.PatchOptions{FieldManager: FieldManager})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = wait.PollImmediateWithContext(ctx, resizePollInterval, timeout, func(ctx context.Context) (bool, error) {
+		pvc, err := pvcs.Get(ctx, "storage", metav1.GetOptions{})
+		if Retryable(err) {
+			// Checked again at the next poll
+			c.logf("checking the storage of %s failed, retrying in %s: %v", namespace, resizePollInterval, err)
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return resized(pvc, size), nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("timed out waiting for the storage of user %s to be resized, check the conditions of the claim", namespace)
+	}
+
+	return err
+}
+
+// Returns true if the claim has reached size and no resize is in progress.
+func resized(pvc *corev1.PersistentVolumeClaim, size apiresource.Quantity) bool {
+	for _, condition := range pvc.Status.Conditions {
+		switch condition.Type {
+		case corev1.PersistentVolumeClaimResizing, corev1.PersistentVolumeClaimFileSystemResizePending:
+			if condition.Status == corev1.ConditionTrue {
+				return false
+			}
+		}
+	}
+
+	capacity := pvc.Status.Capacity[corev1.ResourceStorage]
+	return capacity.Cmp(size) >= 0
+}
@@ -0,0 +1,101 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	internalfake "github.com/uitml/quimby/internal/fake"
+	corev1 "k8s.io/api/core/v1"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Returns a claim that has already been resized to capacity, as a resizer would leave it
+func newResizedPVC(namespace string, size int64, capacity int64) *corev1.PersistentVolumeClaim {
+	pvc := internalfake.NewPVC(namespace, size)
+	pvc.Status.Capacity = corev1.ResourceList{
+		corev1.ResourceStorage: *apiresource.NewQuantity(capacity*1024*1024*1024, apiresource.BinarySI),
+	}
+
+	return pvc
+}
+
+func TestClient_ResizeStorage(t *testing.T) {
+	interval := resizePollInterval
+	resizePollInterval = time.Millisecond
+	t.Cleanup(func() { resizePollInterval = interval })
+
+	type args struct {
+		namespace string
+		size      string
+	}
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		args    args
+		want    string
+		wantErr bool
+	}{
+		// Testcase 1: Expand the volume
+		{
+			name:    "Expand",
+			objects: []runtime.Object{newResizedPVC("foo123", 500, 1000), internalfake.NewStorageClass("nfs-storage", true)},
+			args:    args{namespace: "foo123", size: "1000Gi"},
+			want:    "1000Gi",
+		},
+		// Testcase 2: Same size is a no-op
+		{
+			name:    "Same size",
+			objects: []runtime.Object{internalfake.NewPVC("foo123", 500), internalfake.NewStorageClass("nfs-storage", false)},
+			args:    args{namespace: "foo123", size: "500Gi"},
+			want:    "500Gi",
+		},
+		// Testcase 3: Refuse to shrink
+		{
+			name:    "Shrink",
+			objects: []runtime.Object{internalfake.NewPVC("foo123", 500), internalfake.NewStorageClass("nfs-storage", true)},
+			args:    args{namespace: "foo123", size: "200Gi"},
+			want:    "500Gi",
+			wantErr: true,
+		},
+		// Testcase 4: Storage class does not allow expansion
+		{
+			name:    "Expansion not allowed",
+			objects: []runtime.Object{internalfake.NewPVC("foo123", 500), internalfake.NewStorageClass("nfs-storage", false)},
+			args:    args{namespace: "foo123", size: "1000Gi"},
+			want:    "500Gi",
+			wantErr: true,
+		},
+		// Testcase 5: Resize never finishes
+		{
+			name:    "Timeout",
+			objects: []runtime.Object{internalfake.NewPVC("foo123", 500), internalfake.NewStorageClass("nfs-storage", true)},
+			args:    args{namespace: "foo123", size: "1000Gi"},
+			want:    "1000Gi",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(tt.objects...)
+			c := &Client{Clientset: clientset}
+
+			err := c.ResizeStorage(context.Background(), tt.args.namespace, apiresource.MustParse(tt.args.size), 20*time.Millisecond)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.ResizeStorage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			pvc, err := clientset.CoreV1().PersistentVolumeClaims(tt.args.namespace).Get(context.TODO(), "storage", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+			if got.String() != tt.want {
+				t.Errorf("Client.ResizeStorage() requested size = %v, want %v", got.String(), tt.want)
+			}
+		})
+	}
+}
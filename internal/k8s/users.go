@@ -2,12 +2,14 @@ package k8s
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/openlyinc/pointy"
 	"github.com/uitml/quimby/internal/validate"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	applycorev1 "k8s.io/client-go/applyconfigurations/core/v1"
 	applymetav1 "k8s.io/client-go/applyconfigurations/meta/v1"
 )
@@ -18,8 +20,12 @@ const (
 	LabelUserType          string = "springfield.uit.no/user-type"
 )
 
-func (c *Client) NamespaceList() (*corev1.NamespaceList, error) {
-	namespaceList, err := c.Clientset.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+func (c *Client) NamespaceList(ctx context.Context) (*corev1.NamespaceList, error) {
+	var namespaceList *corev1.NamespaceList
+	err := c.retry(ctx, "listing namespaces", Retryable, func() (err error) {
+		namespaceList, err = c.Clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -27,8 +33,33 @@ func (c *Client) NamespaceList() (*corev1.NamespaceList, error) {
 	return namespaceList, nil
 }
 
-func (c *Client) Namespace(username string) (*corev1.Namespace, error) {
-	namespaces, err := c.NamespaceList()
+// Users returns the namespaces of all users matching the label selector.
+func (c *Client) Users(ctx context.Context, selector string) ([]corev1.Namespace, error) {
+	if _, err := labels.Parse(selector); err != nil {
+		return nil, err
+	}
+
+	var namespaceList *corev1.NamespaceList
+	err := c.retry(ctx, "listing namespaces", Retryable, func() (err error) {
+		namespaceList, err = c.Clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: selector})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var users []corev1.Namespace
+	for _, namespace := range namespaceList.Items {
+		if validate.Username(namespace.Name) {
+			users = append(users, namespace)
+		}
+	}
+
+	return users, nil
+}
+
+func (c *Client) Namespace(ctx context.Context, username string) (*corev1.Namespace, error) {
+	namespaces, err := c.NamespaceList(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -58,8 +89,8 @@ func NewNamespace(name string, labels map[string]string, annotations map[string]
 	return &ns
 }
 
-func (c *Client) UserExists(u string) (bool, error) {
-	namespaces, err := c.NamespaceList()
+func (c *Client) UserExists(ctx context.Context, u string) (bool, error) {
+	namespaces, err := c.NamespaceList(ctx)
 	if err != nil {
 		return false, err
 	}
@@ -73,18 +104,28 @@ func (c *Client) UserExists(u string) (bool, error) {
 	return false, nil
 }
 
-func (c *Client) DeleteUser(u string) error {
+func (c *Client) DeleteUser(ctx context.Context, u string) error {
 	policy := metav1.DeletePropagationForeground
 	opts := metav1.DeleteOptions{GracePeriodSeconds: pointy.Int64(0), PropagationPolicy: &policy}
 
-	err := c.Clientset.CoreV1().Namespaces().Delete(context.TODO(), u, opts)
+	err := c.retry(ctx, "deleting namespace "+u, Retryable, func() error {
+		return c.Clientset.CoreV1().Namespaces().Delete(ctx, u, opts)
+	})
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (c *Client) ApplyMetadata(namespace string, fullName string, email string, userType string) error {
+// ApplyMetadata sets the full name, e-mail and user type of a user. Values owned by other field
+// managers fail with a ConflictError, unless force is set.
+//
+// The fields are applied with MetadataFieldManager, so that the other fields of the namespace,
+// owned by FieldManager, are kept. Fields owned only by FieldManager, as set by the template that
+// created the namespace, are taken over without force. Earlier versions of quimby set the
+// metadata as kubectl, which is also the field manager of kubectl apply, so those fields conflict
+// like any other until they are taken over once.
+func (c *Client) ApplyMetadata(ctx context.Context, namespace string, fullName string, email string, userType string, force bool) error {
 	kind := "Namespace"
 	apiVersion := "v1"
 
@@ -105,18 +146,39 @@ func (c *Client) ApplyMetadata(namespace string, fullName string, email string,
 		},
 	}
 
-	// Using server-side apply.
-	// Fields are managed and have an owner. Set field manager to "kubectl" in order
-	// to avoid any conflicts or hacks (e.g. having to set Force=true).
-	// See https://kubernetes.io/docs/reference/using-api/server-side-apply/#field-management
-	_, err := c.Clientset.CoreV1().Namespaces().Apply(
-		context.TODO(),
-		&config,
-		metav1.ApplyOptions{FieldManager: "kubectl"},
-	)
-	if err != nil {
+	apply := func(force bool) error {
+		err := c.retry(ctx, "applying namespace "+namespace, retryableApply, func() error {
+			_, err := c.Clientset.CoreV1().Namespaces().Apply(
+				ctx,
+				&config,
+				metav1.ApplyOptions{FieldManager: MetadataFieldManager, Force: force},
+			)
+			return err
+		})
+		if err != nil {
+			return applyError("Namespace "+namespace, err)
+		}
+		return nil
+	}
+
+	err := apply(force)
+	var conflict *ConflictError
+	if force || !errors.As(err, &conflict) || !ownedByTemplate(conflict.Conflicts) {
 		return err
 	}
+	c.logf("taking over the metadata of namespace %s from the user template", namespace)
 
-	return nil
+	return apply(true)
+}
+
+// Returns true if all conflicts are with FieldManager, which ApplyMetadata may take the metadata
+// fields over from.
+func ownedByTemplate(conflicts []Conflict) bool {
+	for _, c := range conflicts {
+		if c.Manager != FieldManager {
+			return false
+		}
+	}
+
+	return len(conflicts) > 0
 }
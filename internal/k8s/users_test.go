@@ -1,6 +1,8 @@
 package k8s
 
 import (
+	"context"
+	"reflect"
 	"testing"
 
 	"k8s.io/client-go/kubernetes"
@@ -59,7 +61,7 @@ func TestClient_UserExists(t *testing.T) {
 			c := &Client{
 				Clientset: tt.fields.Clientset,
 			}
-			got, err := c.UserExists(tt.args.u)
+			got, err := c.UserExists(context.Background(), tt.args.u)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Client.UserExists() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -120,9 +122,63 @@ func TestClient_DeleteUser(t *testing.T) {
 			c := &Client{
 				Clientset: tt.fields.Clientset,
 			}
-			if err := c.DeleteUser(tt.args.u); (err != nil) != tt.wantErr {
+			if err := c.DeleteUser(context.Background(), tt.args.u); (err != nil) != tt.wantErr {
 				t.Errorf("Client.DeleteUser() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
+
+func TestClient_Users(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		NewNamespace("foo123", map[string]string{LabelUserType: "phd"}, map[string]string{}),
+		NewNamespace("bar123", map[string]string{LabelUserType: "student"}, map[string]string{}),
+		NewNamespace("kube-system", map[string]string{LabelUserType: "phd"}, map[string]string{}),
+	)
+
+	type args struct {
+		selector string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []string
+		wantErr bool
+	}{
+		// Testcase 1: Empty selector returns all users, but no system namespaces
+		{
+			name: "All users",
+			args: args{selector: ""},
+			want: []string{"bar123", "foo123"},
+		},
+		// Testcase 2: Select by user type
+		{
+			name: "By user type",
+			args: args{selector: LabelUserType + "=phd"},
+			want: []string{"foo123"},
+		},
+		// Testcase 3: Invalid selector
+		{
+			name:    "Invalid selector",
+			args:    args{selector: "=phd"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{Clientset: clientset}
+			got, err := c.Users(context.Background(), tt.args.selector)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.Users() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			var names []string
+			for _, ns := range got {
+				names = append(names, ns.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("Client.Users() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package k8s
+
+import (
+	"sort"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Versions maps the objects of a user, e.g. Deployment storage-proxy, to their metadata.generation
+// when they were read. The generation changes with the spec of an object, but not with its status.
+// Objects without a generation are left out, as their resourceVersion also changes with the
+// status, e.g. with the usage of a ResourceQuota. Compare the specs read from them instead.
+type Versions map[string]string
+
+// Adds the generation of the object of kind, if it has one.
+func (v Versions) add(kind string, obj metav1.Object) {
+	if g := obj.GetGeneration(); g > 0 {
+		v[kind+" "+obj.GetName()] = strconv.FormatInt(g, 10)
+	}
+}
+
+// Changed returns the objects whose version differs in current, sorted.
+func (v Versions) Changed(current Versions) []string {
+	var changed []string
+	for object, version := range v {
+		if current[object] != version {
+			changed = append(changed, object)
+		}
+	}
+	for object := range current {
+		if _, ok := v[object]; !ok {
+			changed = append(changed, object)
+		}
+	}
+	sort.Strings(changed)
+
+	return changed
+}
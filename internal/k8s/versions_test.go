@@ -0,0 +1,49 @@
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestVersions_add(t *testing.T) {
+	v := make(Versions)
+	v.add("Deployment", &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "storage-proxy", Generation: 3, ResourceVersion: "40"}})
+	// Changes to the usage of a quota change its resourceVersion, but it has no generation
+	v.add("ResourceQuota", &corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: "compute-resources", ResourceVersion: "41"}})
+
+	if want := (Versions{"Deployment storage-proxy": "3"}); !reflect.DeepEqual(v, want) {
+		t.Errorf("Versions.add() = %v, want %v", v, want)
+	}
+}
+
+func TestVersions_Changed(t *testing.T) {
+	v := Versions{"Namespace foo123": "10", "ResourceQuota compute-resources": "11", "LimitRange default-limits": "12"}
+	tests := []struct {
+		name    string
+		current Versions
+		want    []string
+	}{
+		{name: "Unchanged", current: Versions{"Namespace foo123": "10", "ResourceQuota compute-resources": "11", "LimitRange default-limits": "12"}},
+		{
+			name:    "Changed and removed",
+			current: Versions{"Namespace foo123": "10", "ResourceQuota compute-resources": "20"},
+			want:    []string{"LimitRange default-limits", "ResourceQuota compute-resources"},
+		},
+		{
+			name:    "Added",
+			current: Versions{"Namespace foo123": "10", "ResourceQuota compute-resources": "11", "LimitRange default-limits": "12", "Deployment storage": "30"},
+			want:    []string{"Deployment storage"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := v.Changed(tt.current); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Versions.Changed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package resource
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ResourceGPU is the extended resource of the GPUs given by the gpu fields of a Spec. Other
+// accelerators, such as MIG slices, are given in Spec.Accelerators.
+const ResourceGPU corev1.ResourceName = "nvidia.com/gpu"
+
+// Requests returns the name of the quota of the requests of resource, e.g.
+// requests.nvidia.com/gpu for nvidia.com/gpu.
+func Requests(name corev1.ResourceName) corev1.ResourceName {
+	return corev1.ResourceName("requests." + string(name))
+}
+
+// ValidateAccelerator returns an error if name is not an extended resource name, which must be
+// prefixed by a domain, e.g. nvidia.com/mig-1g.10gb.
+func ValidateAccelerator(name corev1.ResourceName) error {
+	if !strings.Contains(string(name), "/") || strings.HasPrefix(string(name), "kubernetes.io/") {
+		return fmt.Errorf("invalid accelerator %q, must be an extended resource such as nvidia.com/mig-1g.10gb", name)
+	}
+	if errs := validation.IsQualifiedName(string(name)); len(errs) > 0 {
+		return fmt.Errorf("invalid accelerator %q: %s", name, strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+// AcceleratorNames returns the accelerators set in any of the specs, sorted.
+func AcceleratorNames(specs ...*Spec) []corev1.ResourceName {
+	seen := make(map[corev1.ResourceName]bool)
+	var names []corev1.ResourceName
+	for _, s := range specs {
+		if s == nil {
+			continue
+		}
+		for name := range s.Accelerators {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+
+	return names
+}
+
+// Returns the quota of the accelerator in spec, or nil if it is unset.
+func accelerator(spec *Spec, name corev1.ResourceName) *int64 {
+	v, ok := spec.Accelerators[name]
+	if !ok {
+		return nil
+	}
+	return &v
+}
+
+// AcceleratorKey returns the key of the quota of an accelerator in a Spec, as shown in diffs.
+func AcceleratorKey(name corev1.ResourceName) string {
+	return "accelerators." + string(name)
+}
@@ -0,0 +1,66 @@
+package resource
+
+import "fmt"
+
+// Change is a difference in a single value between two versions of a resource.
+type Change struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// Formats a value of a Spec field for display.
+func formatValue(v *int64, unit Unit) string {
+	if v == nil {
+		return "<unset>"
+	}
+
+	return fmt.Sprintf("%d %s", *v, unit.Name)
+}
+
+// DiffSpec returns the fields that differ between old and new.
+func DiffSpec(old *Spec, new *Spec) []Change {
+	var changes []Change
+
+	for _, f := range SpecFields {
+		o, n := f.Get(old), f.Get(new)
+		if o == nil && n == nil || o != nil && n != nil && *o == *n {
+			continue
+		}
+		changes = append(changes, Change{
+			Field: f.Key,
+			Old:   formatValue(o, f.Unit),
+			New:   formatValue(n, f.Unit),
+		})
+	}
+	for _, name := range AcceleratorNames(old, new) {
+		o, n := accelerator(old, name), accelerator(new, name)
+		if o != nil && n != nil && *o == *n {
+			continue
+		}
+		changes = append(changes, Change{
+			Field: AcceleratorKey(name),
+			Old:   formatValue(o, UnitDevices),
+			New:   formatValue(n, UnitDevices),
+		})
+	}
+	if o, n := FormatGPUModels(old.GPUModels), FormatGPUModels(new.GPUModels); o != n {
+		changes = append(changes, Change{Field: GPUModelsKey, Old: o, New: n})
+	}
+
+	return changes
+}
+
+// Diff returns the keys that differ between old and new, in the order given by keys.
+func Diff(keys []string, old map[string]string, new map[string]string) []Change {
+	var changes []Change
+
+	for _, k := range keys {
+		if old[k] == new[k] {
+			continue
+		}
+		changes = append(changes, Change{Field: k, Old: old[k], New: new[k]})
+	}
+
+	return changes
+}
@@ -0,0 +1,111 @@
+package resource
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/openlyinc/pointy"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestDiffSpec(t *testing.T) {
+	type args struct {
+		old *Spec
+		new *Spec
+	}
+	tests := []struct {
+		name string
+		args args
+		want []Change
+	}{
+		// Testcase 1: Identical specs. No changes
+		{
+			name: "No changes",
+			args: args{
+				old: &Spec{GPU: pointy.Int64(2), StorageSize: pointy.Int64(500)},
+				new: &Spec{GPU: pointy.Int64(2), StorageSize: pointy.Int64(500)},
+			},
+			want: nil,
+		},
+		// Testcase 2: Changed, set and unset values, in field order
+		{
+			name: "Changed, set and unset",
+			args: args{
+				old: &Spec{GPU: pointy.Int64(2), StorageSize: pointy.Int64(500)},
+				new: &Spec{GPU: pointy.Int64(4), MaxMemoryPerJob: pointy.Int64(16)},
+			},
+			want: []Change{
+				{Field: "gpu", Old: "2 GPUs", New: "4 GPUs"},
+				{Field: "maxmemoryperjob", Old: "<unset>", New: "16 GiB"},
+				{Field: "storagesize", Old: "500 GiB", New: "<unset>"},
+			},
+		},
+		// Testcase 3: Accelerators, by resource name
+		{
+			name: "Accelerators",
+			args: args{
+				old: &Spec{Accelerators: map[corev1.ResourceName]int64{"nvidia.com/mig-1g.10gb": 7, "nvidia.com/mig-2g.20gb": 1}},
+				new: &Spec{Accelerators: map[corev1.ResourceName]int64{"nvidia.com/mig-1g.10gb": 7, "nvidia.com/mig-3g.40gb": 2}},
+			},
+			want: []Change{
+				{Field: "accelerators.nvidia.com/mig-2g.20gb", Old: "1 devices", New: "<unset>"},
+				{Field: "accelerators.nvidia.com/mig-3g.40gb", Old: "<unset>", New: "2 devices"},
+			},
+		},
+		// Testcase 4: GPU models, where unset and empty both allow all models
+		{
+			name: "GPU models",
+			args: args{
+				old: &Spec{GPUModels: []string{"NVIDIA-A100-SXM4-40GB"}},
+				new: &Spec{GPUModels: []string{}},
+			},
+			want: []Change{{Field: "gpumodels", Old: "NVIDIA-A100-SXM4-40GB", New: "<all>"}},
+		},
+		{
+			name: "GPU models unset and empty",
+			args: args{old: &Spec{}, new: &Spec{GPUModels: []string{}}},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DiffSpec(tt.args.old, tt.args.new); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffSpec() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpec_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    *Spec
+		wantErr bool
+	}{
+		{"Valid", &Spec{GPU: pointy.Int64(2), Accelerators: map[corev1.ResourceName]int64{"nvidia.com/mig-1g.10gb": 7}}, false},
+		{"Negative field", &Spec{GPU: pointy.Int64(-1)}, true},
+		{"Negative accelerator", &Spec{Accelerators: map[corev1.ResourceName]int64{"nvidia.com/mig-1g.10gb": -1}}, true},
+		{"Accelerator without domain", &Spec{Accelerators: map[corev1.ResourceName]int64{"gpu": 1}}, true},
+		{"GPU model", &Spec{GPUModels: []string{"NVIDIA-A100-SXM4-40GB"}}, false},
+		{"Invalid GPU model", &Spec{GPUModels: []string{"NVIDIA A100"}}, true},
+		{"Two GPU models", &Spec{GPUModels: []string{"NVIDIA-A100-SXM4-40GB", "Tesla-V100-PCIE-32GB"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.spec.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Spec.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSpec_AllowsGPUModel(t *testing.T) {
+	a100 := "NVIDIA-A100-SXM4-40GB"
+	if !(&Spec{}).AllowsGPUModel(a100) {
+		t.Errorf("Spec.AllowsGPUModel() = false without GPU models, want true")
+	}
+	restricted := &Spec{GPUModels: []string{a100}}
+	if !restricted.AllowsGPUModel(a100) || restricted.AllowsGPUModel("Tesla-V100-PCIE-32GB") {
+		t.Errorf("Spec.AllowsGPUModel() does not allow only %s", a100)
+	}
+}
@@ -0,0 +1,65 @@
+package resource
+
+import corev1 "k8s.io/api/core/v1"
+
+// Field describes a single editable value in a Spec.
+type Field struct {
+	Key         string // yaml key
+	Flag        string // command line flag
+	Description string
+	Unit        Unit
+
+	value func(*Spec) **int64
+}
+
+// SpecFields lists every field of a Spec in the order they are presented to the user.
+var SpecFields = []Field{
+	{"gpu", "gpu", "Total number of GPUs in the quota", UnitCount, func(s *Spec) **int64 { return &s.GPU }},
+	{"gpuperjob", "gpu-per-job", "Default number of GPUs per job", UnitCount, func(s *Spec) **int64 { return &s.GPUPerJob }},
+	{"memory", "memory", "Memory quota of all jobs, overrides maxmemoryperjob", UnitGiB, func(s *Spec) **int64 { return &s.Memory }},
+	{"cpu", "cpu", "CPU quota of all jobs, overrides cpuperjob", UnitCores, func(s *Spec) **int64 { return &s.CPU }},
+	{"maxmemoryperjob", "max-memory-per-job", "Memory quota per GPU", UnitGiB, func(s *Spec) **int64 { return &s.MaxMemoryPerJob }},
+	{"defaultmemoryperjob", "default-memory-per-job", "Default memory limit per job", UnitGiB, func(s *Spec) **int64 { return &s.DefaultMemoryPerJob }},
+	{"cpuperjob", "cpu-per-job", "CPU quota per GPU, also the default CPU limit per job", UnitCores, func(s *Spec) **int64 { return &s.CPUPerJob }},
+	{"storageproxycpurequest", "storage-proxy-cpu-request", "CPU request of the storage proxy", UnitMillicores, func(s *Spec) **int64 { return &s.StorageProxyCPURequest }},
+	{"storageproxycpulimit", "storage-proxy-cpu-limit", "CPU limit of the storage proxy", UnitMillicores, func(s *Spec) **int64 { return &s.StorageProxyCPULimit }},
+	{"storageproxymemory", "storage-proxy-memory", "Memory limit of the storage proxy", UnitMiB, func(s *Spec) **int64 { return &s.StorageProxyMemory }},
+	{"storagesize", "storage-size", "Size of the storage volume", UnitGiB, func(s *Spec) **int64 { return &s.StorageSize }},
+}
+
+// Get returns the value of the field in spec, or nil if it is unset.
+func (f Field) Get(spec *Spec) *int64 {
+	return *f.value(spec)
+}
+
+// Set sets the value of the field in spec.
+func (f Field) Set(spec *Spec, v *int64) {
+	*f.value(spec) = v
+}
+
+// Format returns the value of the field in spec for display, with its unit.
+func (f Field) Format(spec *Spec) string {
+	return formatValue(f.Get(spec), f.Unit)
+}
+
+// DeepCopy returns a copy of the spec that shares no pointers with the original.
+func (s *Spec) DeepCopy() *Spec {
+	c := &Spec{}
+	for _, f := range SpecFields {
+		if v := f.Get(s); v != nil {
+			n := *v
+			f.Set(c, &n)
+		}
+	}
+	if s.Accelerators != nil {
+		c.Accelerators = make(map[corev1.ResourceName]int64, len(s.Accelerators))
+		for name, v := range s.Accelerators {
+			c.Accelerators[name] = v
+		}
+	}
+	if s.GPUModels != nil {
+		c.GPUModels = append([]string{}, s.GPUModels...)
+	}
+
+	return c
+}
@@ -0,0 +1,84 @@
+package resource
+
+import corev1 "k8s.io/api/core/v1"
+
+// MergeSpec merges two versions of a spec that were both changed from base, e.g. an edit in
+// ours and a change by someone else in theirs. Fields changed in only one version take the value
+// of that version. Fields changed to different values in both keep the value of ours, and are
+// returned as conflicts, where Old is the value of theirs and New the value of ours.
+func MergeSpec(base *Spec, ours *Spec, theirs *Spec) (*Spec, []Change) {
+	merged := &Spec{}
+	var conflicts []Change
+
+	for _, f := range SpecFields {
+		v, conflict := merge(f.Get(base), f.Get(ours), f.Get(theirs))
+		f.Set(merged, copyValue(v))
+		if conflict {
+			conflicts = append(conflicts, Change{
+				Field: f.Key,
+				Old:   formatValue(f.Get(theirs), f.Unit),
+				New:   formatValue(f.Get(ours), f.Unit),
+			})
+		}
+	}
+	for _, name := range AcceleratorNames(base, ours, theirs) {
+		o, t := accelerator(ours, name), accelerator(theirs, name)
+		v, conflict := merge(accelerator(base, name), o, t)
+		if v != nil {
+			if merged.Accelerators == nil {
+				merged.Accelerators = make(map[corev1.ResourceName]int64)
+			}
+			merged.Accelerators[name] = *v
+		}
+		if conflict {
+			conflicts = append(conflicts, Change{
+				Field: AcceleratorKey(name),
+				Old:   formatValue(t, UnitDevices),
+				New:   formatValue(o, UnitDevices),
+			})
+		}
+	}
+
+	b, o, t := FormatGPUModels(base.GPUModels), FormatGPUModels(ours.GPUModels), FormatGPUModels(theirs.GPUModels)
+	switch {
+	case o == b:
+		merged.GPUModels = theirs.GPUModels
+	case t == b || t == o:
+		merged.GPUModels = ours.GPUModels
+	default:
+		merged.GPUModels = ours.GPUModels
+		conflicts = append(conflicts, Change{Field: GPUModelsKey, Old: t, New: o})
+	}
+	if merged.GPUModels != nil {
+		merged.GPUModels = append([]string{}, merged.GPUModels...)
+	}
+
+	return merged, conflicts
+}
+
+// Returns the three-way merge of a value, and whether ours and theirs changed it differently.
+func merge(base *int64, ours *int64, theirs *int64) (*int64, bool) {
+	switch {
+	case equal(ours, base):
+		return theirs, false
+	case equal(theirs, base), equal(theirs, ours):
+		return ours, false
+	}
+
+	return ours, true
+}
+
+// Returns true if a and b are both unset, or set to the same value.
+func equal(a *int64, b *int64) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
+
+// Returns a pointer to a copy of v, or nil if v is nil.
+func copyValue(v *int64) *int64 {
+	if v == nil {
+		return nil
+	}
+	n := *v
+
+	return &n
+}
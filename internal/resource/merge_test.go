@@ -0,0 +1,70 @@
+package resource
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/openlyinc/pointy"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestMergeSpec(t *testing.T) {
+	mig := corev1.ResourceName("nvidia.com/mig-1g.10gb")
+	tests := []struct {
+		name          string
+		base          *Spec
+		ours          *Spec
+		theirs        *Spec
+		want          *Spec
+		wantConflicts []Change
+	}{
+		{
+			name:   "Changed in different fields",
+			base:   &Spec{GPU: pointy.Int64(2), CPU: pointy.Int64(16), Memory: pointy.Int64(64)},
+			ours:   &Spec{GPU: pointy.Int64(4), CPU: pointy.Int64(16), Memory: pointy.Int64(64)},
+			theirs: &Spec{GPU: pointy.Int64(2), CPU: pointy.Int64(32)},
+			want:   &Spec{GPU: pointy.Int64(4), CPU: pointy.Int64(32)},
+		},
+		{
+			name:   "Changed to the same value",
+			base:   &Spec{GPU: pointy.Int64(2)},
+			ours:   &Spec{GPU: pointy.Int64(4)},
+			theirs: &Spec{GPU: pointy.Int64(4)},
+			want:   &Spec{GPU: pointy.Int64(4)},
+		},
+		{
+			name:          "Changed to different values",
+			base:          &Spec{GPU: pointy.Int64(2), StorageSize: pointy.Int64(100)},
+			ours:          &Spec{GPU: pointy.Int64(4), StorageSize: pointy.Int64(100)},
+			theirs:        &Spec{StorageSize: pointy.Int64(200)},
+			want:          &Spec{GPU: pointy.Int64(4), StorageSize: pointy.Int64(200)},
+			wantConflicts: []Change{{Field: "gpu", Old: "<unset>", New: "4 GPUs"}},
+		},
+		{
+			name:          "Accelerators",
+			base:          &Spec{Accelerators: map[corev1.ResourceName]int64{mig: 7}},
+			ours:          &Spec{Accelerators: map[corev1.ResourceName]int64{mig: 3}},
+			theirs:        &Spec{Accelerators: map[corev1.ResourceName]int64{mig: 1}},
+			want:          &Spec{Accelerators: map[corev1.ResourceName]int64{mig: 3}},
+			wantConflicts: []Change{{Field: "accelerators.nvidia.com/mig-1g.10gb", Old: "1 devices", New: "3 devices"}},
+		},
+		{
+			name:   "GPU models changed by theirs",
+			base:   &Spec{GPU: pointy.Int64(2)},
+			ours:   &Spec{GPU: pointy.Int64(4)},
+			theirs: &Spec{GPU: pointy.Int64(2), GPUModels: []string{"NVIDIA-A100-SXM4-40GB"}},
+			want:   &Spec{GPU: pointy.Int64(4), GPUModels: []string{"NVIDIA-A100-SXM4-40GB"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflicts := MergeSpec(tt.base, tt.ours, tt.theirs)
+			if diff := DiffSpec(tt.want, got); len(diff) > 0 {
+				t.Errorf("MergeSpec() differs from want: %v", diff)
+			}
+			if !reflect.DeepEqual(conflicts, tt.wantConflicts) {
+				t.Errorf("MergeSpec() conflicts = %v, want %v", conflicts, tt.wantConflicts)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package resource
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// GPUModelsKey is the key of Spec.GPUModels, which is not one of SpecFields.
+const GPUModelsKey = "gpumodels"
+
+// MaxGPUModels is the number of GPU models a spec can be restricted to. A single model is
+// enforced with a node selector on the namespace, while the cluster has no way to enforce a
+// choice between several models.
+const MaxGPUModels = 1
+
+// AllowsGPUModel returns true if jobs of the spec may run on GPUs of the given product, as
+// given by the nvidia.com/gpu.product label of the nodes. All models are allowed if GPUModels
+// is empty.
+func (s *Spec) AllowsGPUModel(product string) bool {
+	if len(s.GPUModels) == 0 {
+		return true
+	}
+	for _, m := range s.GPUModels {
+		if m == product {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidateGPUModel returns an error if model can not be the value of a node label.
+func ValidateGPUModel(model string) error {
+	if model == "" {
+		return fmt.Errorf("%s: model must not be empty", GPUModelsKey)
+	}
+	if errs := validation.IsValidLabelValue(model); len(errs) > 0 {
+		return fmt.Errorf("%s: invalid model %q: %s", GPUModelsKey, model, strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+// FormatGPUModels returns the GPU models for display.
+func FormatGPUModels(models []string) string {
+	if len(models) == 0 {
+		return "<all>"
+	}
+	return strings.Join(models, ", ")
+}
@@ -1,8 +1,16 @@
 package resource
 
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
 type Spec struct {
 	GPU                    *int64 `yaml:"gpu,omitempty"`
 	GPUPerJob              *int64 `yaml:"gpuperjob,omitempty"`
+	Memory                 *int64 `yaml:"memory,omitempty"`
+	CPU                    *int64 `yaml:"cpu,omitempty"`
 	MaxMemoryPerJob        *int64 `yaml:"maxmemoryperjob,omitempty"`
 	DefaultMemoryPerJob    *int64 `yaml:"defaultmemoryperjob,omitempty"`
 	CPUPerJob              *int64 `yaml:"cpuperjob,omitempty"`
@@ -10,6 +18,12 @@ type Spec struct {
 	StorageProxyCPULimit   *int64 `yaml:"storageproxycpulimit,omitempty"`
 	StorageProxyMemory     *int64 `yaml:"storageproxymemory,omitempty"`
 	StorageSize            *int64 `yaml:"storagesize,omitempty"`
+
+	// Quota of the accelerators besides nvidia.com/gpu, keyed by extended resource name
+	Accelerators map[corev1.ResourceName]int64 `yaml:"accelerators,omitempty"`
+
+	// GPU products the jobs may run on, all if empty. Nil leaves them unchanged when merged.
+	GPUModels []string `yaml:"gpumodels,omitempty"`
 }
 
 type Summary struct {
@@ -22,6 +36,21 @@ type Quota struct {
 	CPU     Summary
 	Memory  Summary
 	Storage int64
+
+	// Accelerators besides nvidia.com/gpu, keyed by extended resource name
+	Accelerators map[corev1.ResourceName]Summary
+}
+
+// Capacity is what the schedulable nodes of a cluster provide.
+type Capacity struct {
+	Resources map[corev1.ResourceName]Summary // nvidia.com/gpu and the other accelerators
+	GPUModels map[string]int64                // nvidia.com/gpu by the product label of the nodes
+}
+
+// Cluster holds read-only facts about the cluster, available to templates.
+type Cluster struct {
+	MaxNodeGPUs int64  // GPUs of the largest schedulable node
+	GPUProduct  string // GPU product of that node, from its nvidia.com/gpu.product label
 }
 
 type Request struct {
@@ -29,3 +58,56 @@ type Request struct {
 	CPU    int64
 	Memory int64
 }
+
+// TotalMemory returns the memory quota of all jobs in GiB. That is Memory if it is set, and
+// otherwise MaxMemoryPerJob for every GPU.
+func (s *Spec) TotalMemory() int64 {
+	if s.Memory != nil {
+		return *s.Memory
+	}
+	return value(s.MaxMemoryPerJob) * value(s.GPU)
+}
+
+// TotalCPU returns the CPU quota of all jobs in cores. That is CPU if it is set, and otherwise
+// CPUPerJob for every GPU.
+func (s *Spec) TotalCPU() int64 {
+	if s.CPU != nil {
+		return *s.CPU
+	}
+	return value(s.CPUPerJob) * value(s.GPU)
+}
+
+// Dereferences v, treating nil as zero.
+func value(v *int64) int64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+// Validate checks that all values in the spec are sensible.
+func (s *Spec) Validate() error {
+	for _, f := range SpecFields {
+		if v := f.Get(s); v != nil && *v < 0 {
+			return fmt.Errorf("%s: must not be negative, got %d", f.Key, *v)
+		}
+	}
+	for _, name := range AcceleratorNames(s) {
+		if err := ValidateAccelerator(name); err != nil {
+			return err
+		}
+		if v := s.Accelerators[name]; v < 0 {
+			return fmt.Errorf("%s: must not be negative, got %d", AcceleratorKey(name), v)
+		}
+	}
+	if len(s.GPUModels) > MaxGPUModels {
+		return fmt.Errorf("%s: at most %d model can be enforced, got %d", GPUModelsKey, MaxGPUModels, len(s.GPUModels))
+	}
+	for _, m := range s.GPUModels {
+		if err := ValidateGPUModel(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
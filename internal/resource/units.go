@@ -0,0 +1,60 @@
+package resource
+
+import (
+	"fmt"
+	"strconv"
+
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Unit is the unit a Spec field is expressed in.
+type Unit struct {
+	Name string
+
+	milliPer int64 // number of milli base units (milli bytes, millicores etc.) per unit
+	format   apiresource.Format
+}
+
+var (
+	UnitCount      = Unit{"GPUs", 1000, apiresource.DecimalSI}
+	UnitDevices    = Unit{"devices", 1000, apiresource.DecimalSI}
+	UnitCores      = Unit{"cores", 1000, apiresource.DecimalSI}
+	UnitMillicores = Unit{"millicores", 1, apiresource.DecimalSI}
+	UnitGiB        = Unit{"GiB", 1000 * 1024 * 1024 * 1024, apiresource.BinarySI}
+	UnitMiB        = Unit{"MiB", 1000 * 1024 * 1024, apiresource.BinarySI}
+)
+
+// Parse converts s to a value in the unit. Plain integers are taken to already be in the unit,
+// anything else is parsed as a Kubernetes quantity, e.g. 32Gi or 500m.
+func (u Unit) Parse(s string) (int64, error) {
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return v, nil
+	}
+
+	q, err := apiresource.ParseQuantity(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid quantity %q", s)
+	}
+
+	return u.FromQuantity(q)
+}
+
+// FromQuantity converts q to a value in the unit. The quantity must be a whole number of units.
+func (u Unit) FromQuantity(q apiresource.Quantity) (int64, error) {
+	milli := q.MilliValue()
+	if milli%u.milliPer != 0 {
+		return 0, fmt.Errorf("%s is not a whole number of %s", q.String(), u.Name)
+	}
+
+	return milli / u.milliPer, nil
+}
+
+// Quantity converts v in the unit to a Kubernetes quantity.
+func (u Unit) Quantity(v int64) *apiresource.Quantity {
+	return apiresource.NewMilliQuantity(v*u.milliPer, u.format)
+}
+
+// Truncate converts q to a value in the unit, rounding down to a whole number of units.
+func (u Unit) Truncate(q apiresource.Quantity) int64 {
+	return q.MilliValue() / u.milliPer
+}
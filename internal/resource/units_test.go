@@ -0,0 +1,69 @@
+package resource
+
+import "testing"
+
+func TestUnit_Parse(t *testing.T) {
+	type args struct {
+		unit Unit
+		s    string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    int64
+		wantErr bool
+	}{
+		{
+			name: "Plain integer is in the unit",
+			args: args{unit: UnitGiB, s: "32"},
+			want: 32,
+		},
+		{
+			name: "Binary quantity",
+			args: args{unit: UnitGiB, s: "32Gi"},
+			want: 32,
+		},
+		{
+			name: "Binary quantity in a smaller unit",
+			args: args{unit: UnitMiB, s: "1Gi"},
+			want: 1024,
+		},
+		{
+			name: "Milli quantity",
+			args: args{unit: UnitMillicores, s: "500m"},
+			want: 500,
+		},
+		{
+			name: "Whole cores as millicores",
+			args: args{unit: UnitMillicores, s: "2.5"},
+			want: 2500,
+		},
+		{
+			name:    "Fractional cores",
+			args:    args{unit: UnitCores, s: "500m"},
+			wantErr: true,
+		},
+		{
+			name:    "Not a whole number of GiB",
+			args:    args{unit: UnitGiB, s: "1500Mi"},
+			wantErr: true,
+		},
+		{
+			name:    "Garbage",
+			args:    args{unit: UnitCount, s: "four"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.args.unit.Parse(tt.args.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Unit.Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Unit.Parse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
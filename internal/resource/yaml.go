@@ -0,0 +1,165 @@
+package resource
+
+import (
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Format returns v in the unit as a Kubernetes quantity string, e.g. 32Gi or 500m.
+func (u Unit) Format(v int64) string {
+	return u.Quantity(v).String()
+}
+
+// MarshalYAML emits the set fields of the spec as Kubernetes quantity strings, in the order of
+// SpecFields. Values that are the same as a plain integer in the unit are emitted as integers.
+func (s Spec) MarshalYAML() (interface{}, error) {
+	var out yaml.MapSlice
+	for _, f := range SpecFields {
+		v := f.Get(&s)
+		if v == nil {
+			continue
+		}
+		var value interface{} = f.Unit.Format(*v)
+		if value == strconv.FormatInt(*v, 10) {
+			value = *v
+		}
+		out = append(out, yaml.MapItem{Key: f.Key, Value: value})
+	}
+	if len(s.Accelerators) > 0 {
+		var accelerators yaml.MapSlice
+		for _, name := range AcceleratorNames(&s) {
+			accelerators = append(accelerators, yaml.MapItem{Key: string(name), Value: s.Accelerators[name]})
+		}
+		out = append(out, yaml.MapItem{Key: "accelerators", Value: accelerators})
+	}
+	if s.GPUModels != nil {
+		out = append(out, yaml.MapItem{Key: GPUModelsKey, Value: s.GPUModels})
+	}
+
+	return out, nil
+}
+
+// UnmarshalYAML accepts Kubernetes quantity strings, as well as plain integers in the unit of
+// each field for backwards compatibility. A quoted number is a quantity, so "2" is 2 cores while
+// 2 is 2 millicores for a field in millicores. Fields that are not given are left as they are,
+// and unknown fields are an error.
+func (s *Spec) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw yaml.MapSlice
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	for _, item := range raw {
+		key := fmt.Sprint(item.Key)
+		if key == "accelerators" {
+			if err := s.unmarshalAccelerators(item.Value); err != nil {
+				return fmt.Errorf("accelerators: %w", err)
+			}
+			continue
+		}
+		if key == GPUModelsKey {
+			if err := s.unmarshalGPUModels(item.Value); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			continue
+		}
+		f, ok := fieldByKey(key)
+		if !ok {
+			return fmt.Errorf("unknown field %q", key)
+		}
+		if item.Value == nil {
+			continue
+		}
+		v, err := parseValue(f.Unit, item.Value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		f.Set(s, &v)
+	}
+
+	return nil
+}
+
+// Sets the accelerators given in value, a map of extended resource names to counts.
+func (s *Spec) unmarshalAccelerators(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	items, ok := value.(yaml.MapSlice)
+	if !ok {
+		return fmt.Errorf("must be a map of resource names to counts")
+	}
+
+	for _, item := range items {
+		name := corev1.ResourceName(fmt.Sprint(item.Key))
+		if item.Value == nil {
+			continue
+		}
+		v, err := parseValue(UnitDevices, item.Value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if s.Accelerators == nil {
+			s.Accelerators = make(map[corev1.ResourceName]int64)
+		}
+		s.Accelerators[name] = v
+	}
+
+	return nil
+}
+
+// Sets the GPU models given in value, a list of GPU products. An empty list allows all models.
+func (s *Spec) unmarshalGPUModels(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return fmt.Errorf("must be a list of GPU products")
+	}
+
+	models := []string{}
+	for _, item := range items {
+		m, ok := item.(string)
+		if !ok {
+			return fmt.Errorf("invalid model %v", item)
+		}
+		models = append(models, m)
+	}
+	s.GPUModels = models
+
+	return nil
+}
+
+// Converts a YAML value to the unit. Integers are already in the unit, anything else is a quantity.
+func parseValue(u Unit, value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case string, float64:
+		q, err := apiresource.ParseQuantity(fmt.Sprint(v))
+		if err != nil {
+			return 0, fmt.Errorf("invalid quantity %q", v)
+		}
+		return u.FromQuantity(q)
+	}
+
+	return 0, fmt.Errorf("invalid value %v", value)
+}
+
+// Returns the field with the given key.
+func fieldByKey(key string) (Field, bool) {
+	for _, f := range SpecFields {
+		if f.Key == key {
+			return f, true
+		}
+	}
+
+	return Field{}, false
+}
@@ -0,0 +1,130 @@
+package resource
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/openlyinc/pointy"
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSpec_MarshalYAML(t *testing.T) {
+	spec := &Spec{
+		GPU:                    pointy.Int64(2),
+		MaxMemoryPerJob:        pointy.Int64(32),
+		CPUPerJob:              pointy.Int64(4),
+		StorageProxyCPURequest: pointy.Int64(500),
+		StorageProxyCPULimit:   pointy.Int64(2000),
+		StorageProxyMemory:     pointy.Int64(256),
+		StorageSize:            pointy.Int64(1024),
+		Accelerators:           map[corev1.ResourceName]int64{"nvidia.com/mig-2g.20gb": 1, "nvidia.com/mig-1g.10gb": 7},
+		GPUModels:              []string{"NVIDIA-A100-SXM4-40GB"},
+	}
+	want := `gpu: 2
+maxmemoryperjob: 32Gi
+cpuperjob: 4
+storageproxycpurequest: 500m
+storageproxycpulimit: "2"
+storageproxymemory: 256Mi
+storagesize: 1Ti
+accelerators:
+  nvidia.com/mig-1g.10gb: 7
+  nvidia.com/mig-2g.20gb: 1
+gpumodels:
+- NVIDIA-A100-SXM4-40GB
+`
+
+	got, err := yaml.Marshal(spec)
+	if err != nil {
+		t.Fatalf("yaml.Marshal() error = %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("yaml.Marshal() = %s, want %s", got, want)
+	}
+
+	roundTrip := &Spec{}
+	if err := yaml.UnmarshalStrict(got, roundTrip); err != nil {
+		t.Fatalf("yaml.UnmarshalStrict() error = %v", err)
+	}
+	if !reflect.DeepEqual(roundTrip, spec) {
+		t.Errorf("yaml.UnmarshalStrict() = %v, want %v", DiffSpec(spec, roundTrip), spec)
+	}
+}
+
+func TestSpec_UnmarshalYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    *Spec
+		wantErr bool
+	}{
+		{
+			name: "Plain integers are in the unit of the field",
+			in:   "gpu: 2\nmaxmemoryperjob: 32\nstorageproxycpulimit: 500\nstorageproxymemory: 256\n",
+			want: &Spec{GPU: pointy.Int64(2), MaxMemoryPerJob: pointy.Int64(32), StorageProxyCPULimit: pointy.Int64(500), StorageProxyMemory: pointy.Int64(256)},
+		},
+		{
+			name: "Quantities",
+			in:   "maxmemoryperjob: 32Gi\nstorageproxycpulimit: 1.5\nstorageproxymemory: 1Gi\nstoragesize: 2Ti\n",
+			want: &Spec{MaxMemoryPerJob: pointy.Int64(32), StorageProxyCPULimit: pointy.Int64(1500), StorageProxyMemory: pointy.Int64(1024), StorageSize: pointy.Int64(2048)},
+		},
+		{
+			name: "Quoted numbers are quantities",
+			in:   "gpu: \"2\"\nstorageproxycpulimit: \"2\"\n",
+			want: &Spec{GPU: pointy.Int64(2), StorageProxyCPULimit: pointy.Int64(2000)},
+		},
+		{
+			name: "Null values are unset",
+			in:   "gpu:\n",
+			want: &Spec{},
+		},
+		{
+			name: "Accelerators",
+			in:   "accelerators:\n  nvidia.com/mig-1g.10gb: 7\n  nvidia.com/mig-2g.20gb: \"1\"\n",
+			want: &Spec{Accelerators: map[corev1.ResourceName]int64{"nvidia.com/mig-1g.10gb": 7, "nvidia.com/mig-2g.20gb": 1}},
+		},
+		{
+			name: "An empty list of GPU models is set",
+			in:   "gpumodels: []\n",
+			want: &Spec{GPUModels: []string{}},
+		},
+		{
+			name:    "GPU models not a list",
+			in:      "gpumodels: A100\n",
+			wantErr: true,
+		},
+		{
+			name:    "Accelerators not a map",
+			in:      "accelerators: 2\n",
+			wantErr: true,
+		},
+		{
+			name:    "Not a whole number of units",
+			in:      "maxmemoryperjob: 1500Mi\n",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid quantity",
+			in:      "storagesize: lots\n",
+			wantErr: true,
+		},
+		{
+			name:    "Unknown field",
+			in:      "gpus: 2\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := &Spec{}
+			err := yaml.Unmarshal([]byte(tt.in), got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("yaml.Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("yaml.Unmarshal() = %v, want %v", DiffSpec(tt.want, got), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+// Package templates holds the default values and quimby template compiled into the binary, along
+// with the golden files of the template. They are used when no template source is configured, and
+// are a starting point for new template repos.
+package templates
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// Paths of the embedded files within FS.
+const (
+	ValuesPath   = "values/default-user.yaml"
+	TemplatePath = "config/default-user-quimby.yaml"
+)
+
+//go:embed values config
+var FS embed.FS
+
+// Files returns the paths of all embedded files, including the golden files of the template.
+func Files() ([]string, error) {
+	var files []string
+	err := fs.WalkDir(FS, ".", func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, p)
+		}
+		return err
+	})
+
+	return files, err
+}
@@ -0,0 +1,49 @@
+package templates
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/uitml/quimby/internal/user"
+	"github.com/uitml/quimby/internal/user/reader"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// Renders the embedded template with every lint case, and compares the result to the golden files.
+func TestTemplates(t *testing.T) {
+	rdr := &reader.FS{FS: FS}
+	values := user.Config{}
+	if err := values.Populate(ValuesPath, rdr); err != nil {
+		t.Fatalf("Populate() error = %v", err)
+	}
+
+	for _, c := range user.LintCases(values) {
+		t.Run(c.Name, func(t *testing.T) {
+			got, err := user.Lint(TemplatePath, rdr, c.Config, nil)
+			if err != nil {
+				t.Fatalf("Lint() error = %v", err)
+			}
+
+			golden := filepath.FromSlash(user.GoldenPath(TemplatePath, c.Name))
+			if *update {
+				if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("render of %s differs from %s, run go test with -update to update it:\n%s", c.Name, golden, got)
+			}
+		})
+	}
+}
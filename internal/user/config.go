@@ -2,11 +2,12 @@ package user
 
 import (
 	"bytes"
+	"fmt"
 	"text/template"
 
-	"github.com/Masterminds/sprig"
 	"github.com/uitml/quimby/internal/resource"
 	"github.com/uitml/quimby/internal/user/reader"
+	"github.com/uitml/quimby/internal/validate"
 	"gopkg.in/yaml.v2"
 )
 
@@ -14,6 +15,31 @@ type Config struct {
 	Username       string `yaml:"username,omitempty"`
 	*Metadata      `yaml:"metadata,omitempty"`
 	*resource.Spec `yaml:"resourcespec,omitempty"`
+
+	// Facts about the cluster, filled in from the cluster and not from values files
+	Cluster resource.Cluster `yaml:"-"`
+}
+
+// The serialized form of Config. Config embeds *resource.Spec, which would otherwise promote the
+// YAML methods of Spec to Config.
+type configYAML struct {
+	Username string         `yaml:"username,omitempty"`
+	Metadata *Metadata      `yaml:"metadata,omitempty"`
+	Spec     *resource.Spec `yaml:"resourcespec,omitempty"`
+}
+
+func (usr Config) MarshalYAML() (interface{}, error) {
+	return configYAML{Username: usr.Username, Metadata: usr.Metadata, Spec: usr.Spec}, nil
+}
+
+func (usr *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	c := configYAML{Username: usr.Username, Metadata: usr.Metadata, Spec: usr.Spec}
+	if err := unmarshal(&c); err != nil {
+		return err
+	}
+	usr.Username, usr.Metadata, usr.Spec = c.Username, c.Metadata, c.Spec
+
+	return nil
 }
 
 type Metadata struct {
@@ -22,6 +48,15 @@ type Metadata struct {
 	Usertype string `yaml:"usertype"`
 }
 
+// Validate checks that the metadata is well-formed.
+func (md *Metadata) Validate() error {
+	if md.Email != "" && !validate.Email(md.Email) {
+		return fmt.Errorf("email: invalid address %q", md.Email)
+	}
+
+	return nil
+}
+
 // Populates usr given a path to a yaml file using the Reader
 func (usr *Config) Populate(path string, rdr reader.Config) error {
 	body, err := rdr.Read(path)
@@ -36,14 +71,15 @@ func (usr *Config) Populate(path string, rdr reader.Config) error {
 	return nil
 }
 
-// Generate config from the template in path. Populate with values from usr.
+// Generate config from the template in path. Populate with values from usr. The template can use
+// the functions of FuncMap.
 func GenerateConfig(path string, rdr reader.Config, usr Config) ([]byte, error) {
 	body, err := rdr.Read(path)
 	if err != nil {
 		return nil, err
 	}
 
-	templ, err := template.New("default").Funcs(sprig.TxtFuncMap()).Parse(string(body))
+	templ, err := template.New("default").Funcs(FuncMap()).Parse(string(body))
 	if err != nil {
 		return nil, err
 	}
@@ -56,3 +92,39 @@ func GenerateConfig(path string, rdr reader.Config, usr Config) ([]byte, error)
 
 	return b.Bytes(), nil
 }
+
+// Diff returns the fields that differ between md and other.
+func (md *Metadata) Diff(other *Metadata) []resource.Change {
+	return resource.Diff([]string{"fullname", "email", "usertype"}, md.fields(), other.fields())
+}
+
+func (md *Metadata) fields() map[string]string {
+	return map[string]string{
+		"fullname": md.Fullname,
+		"email":    md.Email,
+		"usertype": md.Usertype,
+	}
+}
+
+// MergeMetadata merges two versions of metadata that were both changed from base, e.g. an edit
+// in ours and a change by someone else in theirs. Fields changed in only one version take the
+// value of that version. Fields changed to different values in both keep the value of ours, and
+// are returned as conflicts, where Old is the value of theirs and New the value of ours.
+func MergeMetadata(base *Metadata, ours *Metadata, theirs *Metadata) (*Metadata, []resource.Change) {
+	b, o, t := base.fields(), ours.fields(), theirs.fields()
+	merged := make(map[string]string)
+	var conflicts []resource.Change
+	for _, key := range []string{"fullname", "email", "usertype"} {
+		switch {
+		case o[key] == b[key]:
+			merged[key] = t[key]
+		case t[key] == b[key], t[key] == o[key]:
+			merged[key] = o[key]
+		default:
+			merged[key] = o[key]
+			conflicts = append(conflicts, resource.Change{Field: key, Old: t[key], New: o[key]})
+		}
+	}
+
+	return &Metadata{Fullname: merged["fullname"], Email: merged["email"], Usertype: merged["usertype"]}, conflicts
+}
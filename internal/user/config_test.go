@@ -150,3 +150,39 @@ func TestGenerateConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestMergeMetadata(t *testing.T) {
+	base := &Metadata{Fullname: "Foo Bar", Email: "foo@uit.no", Usertype: "student"}
+	tests := []struct {
+		name          string
+		ours          *Metadata
+		theirs        *Metadata
+		want          *Metadata
+		wantConflicts []resource.Change
+	}{
+		{
+			name:   "Changed in different fields",
+			ours:   &Metadata{Fullname: "Foo Baz", Email: "foo@uit.no", Usertype: "student"},
+			theirs: &Metadata{Fullname: "Foo Bar", Email: "foo@uit.no", Usertype: "phd"},
+			want:   &Metadata{Fullname: "Foo Baz", Email: "foo@uit.no", Usertype: "phd"},
+		},
+		{
+			name:          "Changed to different values",
+			ours:          &Metadata{Fullname: "Foo Bar", Email: "foo@uit.no", Usertype: "staff"},
+			theirs:        &Metadata{Fullname: "Foo Bar", Email: "bar@uit.no", Usertype: "phd"},
+			want:          &Metadata{Fullname: "Foo Bar", Email: "bar@uit.no", Usertype: "staff"},
+			wantConflicts: []resource.Change{{Field: "usertype", Old: "phd", New: "staff"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflicts := MergeMetadata(base, tt.ours, tt.theirs)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MergeMetadata() = %+v, want %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(conflicts, tt.wantConflicts) {
+				t.Errorf("MergeMetadata() conflicts = %v, want %v", conflicts, tt.wantConflicts)
+			}
+		})
+	}
+}
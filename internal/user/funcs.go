@@ -0,0 +1,122 @@
+package user
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig"
+	"gopkg.in/yaml.v2"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Functions of sprig available to templates. Only functions that depend on nothing but their
+// arguments are listed, so that a render is reproducible and can not leak secrets of the admin,
+// such as QUIMBY_GITHUBTOKEN, into the cluster. Functions added by new releases of sprig are not
+// available until they are listed here.
+var sprigFuncs = []string{
+	// Strings
+	"abbrev", "abbrevboth", "camelcase", "cat", "contains", "hasPrefix", "hasSuffix", "indent",
+	"initials", "join", "kebabcase", "lower", "nindent", "nospace", "plural", "quote", "repeat",
+	"replace", "snakecase", "sortAlpha", "split", "splitList", "splitn", "squote", "substr",
+	"swapcase", "title", "toString", "toStrings", "trim", "trimAll", "trimPrefix", "trimSuffix",
+	"trunc", "untitle", "upper", "wrap", "wrapWith",
+	"regexFind", "regexFindAll", "regexMatch", "regexReplaceAll", "regexReplaceAllLiteral", "regexSplit",
+
+	// Numbers
+	"add", "add1", "atoi", "biggest", "ceil", "div", "float64", "floor", "int", "int64", "max",
+	"min", "mod", "mul", "round", "sub",
+
+	// Lists and dicts
+	"append", "compact", "concat", "first", "has", "initial", "last", "list", "prepend", "push",
+	"rest", "reverse", "slice", "tuple", "uniq", "until", "untilStep", "without",
+	"deepCopy", "dict", "hasKey", "keys", "merge", "mergeOverwrite", "omit", "pick", "pluck",
+	"set", "unset", "values",
+
+	// Defaults, flow control and types
+	"coalesce", "default", "empty", "fail", "ternary",
+	"deepEqual", "kindIs", "kindOf", "typeIs", "typeIsLike", "typeOf",
+
+	// Encodings and checksums
+	"adler32sum", "b32dec", "b32enc", "b64dec", "b64enc", "sha1sum", "sha256sum", "toJson",
+	"toPrettyJson",
+
+	// Versions
+	"semver", "semverCompare",
+}
+
+// FuncMap returns the functions available to templates: the functions of sprig in sprigFuncs,
+// and helpers for Kubernetes quantities.
+func FuncMap() template.FuncMap {
+	all := sprig.TxtFuncMap()
+	funcs := make(template.FuncMap)
+	for _, name := range sprigFuncs {
+		funcs[name] = all[name]
+	}
+
+	funcs["gi"] = func(v interface{}) (string, error) { return withSuffix(v, "Gi") }
+	funcs["mi"] = func(v interface{}) (string, error) { return withSuffix(v, "Mi") }
+	funcs["milli"] = func(v interface{}) (string, error) { return withSuffix(v, "m") }
+	funcs["quantity"] = quantity
+	funcs["toYaml"] = toYaml
+
+	return funcs
+}
+
+// Returns the integer value of v, which may be a pointer such as the fields of resource.Spec.
+func toInt64(v interface{}) (int64, error) {
+	switch n := v.(type) {
+	case *int64:
+		if n == nil {
+			return 0, nil
+		}
+		return *n, nil
+	case int64:
+		return n, nil
+	case int:
+		return int64(n), nil
+	case int32:
+		return int64(n), nil
+	case float64:
+		if n != float64(int64(n)) {
+			return 0, fmt.Errorf("%v is not a whole number", n)
+		}
+		return int64(n), nil
+	}
+
+	return 0, fmt.Errorf("%v is not a number", v)
+}
+
+// Formats the integer v with a quantity suffix, e.g. 32Gi.
+func withSuffix(v interface{}, suffix string) (string, error) {
+	n, err := toInt64(v)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%d%s", n, suffix), nil
+}
+
+// Returns the canonical form of a quantity, e.g. 1536Mi for 1.5Gi. Fails the render if v is not
+// a valid quantity.
+func quantity(v interface{}) (string, error) {
+	if n, err := toInt64(v); err == nil {
+		return apiresource.NewQuantity(n, apiresource.DecimalSI).String(), nil
+	}
+	q, err := apiresource.ParseQuantity(fmt.Sprint(v))
+	if err != nil {
+		return "", fmt.Errorf("quantity %q: %w", v, err)
+	}
+
+	return q.String(), nil
+}
+
+// Returns v as YAML, without a trailing newline. Use with indent or nindent to nest it.
+func toYaml(v interface{}) (string, error) {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(string(b), "\n"), nil
+}
@@ -0,0 +1,70 @@
+package user
+
+import (
+	"bytes"
+	"testing"
+	"text/template"
+
+	"github.com/Masterminds/sprig"
+	"github.com/openlyinc/pointy"
+	"github.com/uitml/quimby/internal/resource"
+)
+
+func TestFuncMap(t *testing.T) {
+	t.Setenv("QUIMBY_GITHUBTOKEN", "secret")
+
+	usr := Config{
+		Username: "foo123",
+		Spec:     &resource.Spec{GPU: pointy.Int64(2), MaxMemoryPerJob: pointy.Int64(16), StorageProxyCPULimit: pointy.Int64(500)},
+		Cluster:  resource.Cluster{MaxNodeGPUs: 8, GPUProduct: "NVIDIA-A100-SXM4-40GB"},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{name: "gi", template: `{{ gi .MaxMemoryPerJob }}`, want: "16Gi"},
+		{name: "gi of expression", template: `{{ gi (mul .MaxMemoryPerJob .GPU) }}`, want: "32Gi"},
+		{name: "mi", template: `{{ mi 256 }}`, want: "256Mi"},
+		{name: "milli", template: `{{ milli .StorageProxyCPULimit }}`, want: "500m"},
+		{name: "gi of unset field", template: `{{ gi .StorageSize }}`, want: "0Gi"},
+		{name: "gi of string", template: `{{ gi "16" }}`, wantErr: true},
+		{name: "quantity", template: `{{ quantity "1.5Gi" }}`, want: "1536Mi"},
+		{name: "quantity of number", template: `{{ quantity .GPU }}`, want: "2"},
+		{name: "invalid quantity", template: `{{ quantity "16 GiB" }}`, wantErr: true},
+		{name: "toYaml", template: `{{ toYaml (dict "a" 1) | indent 2 }}`, want: "  a: 1"},
+		{name: "default", template: `{{ .Cluster.GPUProduct | default "any" }}`, want: "NVIDIA-A100-SXM4-40GB"},
+		{name: "cluster facts", template: `{{ min .GPU .Cluster.MaxNodeGPUs }}`, want: "2"},
+		{name: "env is not available", template: `{{ env "QUIMBY_GITHUBTOKEN" }}`, wantErr: true},
+		{name: "expandenv is not available", template: `{{ expandenv "$QUIMBY_GITHUBTOKEN" }}`, wantErr: true},
+		{name: "path functions are not available", template: `{{ base "/etc/passwd" }}`, wantErr: true},
+		{name: "random functions are not available", template: `{{ randAlpha 8 }}`, wantErr: true},
+		{name: "time functions are not available", template: `{{ now }}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			templ, err := template.New("test").Funcs(FuncMap()).Parse(tt.template)
+			var b bytes.Buffer
+			if err == nil {
+				err = templ.Execute(&b, usr)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("render error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := b.String(); !tt.wantErr && got != tt.want {
+				t.Errorf("render = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSprigFuncs(t *testing.T) {
+	all := sprig.TxtFuncMap()
+	for _, name := range sprigFuncs {
+		if all[name] == nil {
+			t.Errorf("sprigFuncs lists %s, which sprig does not have", name)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package user
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/openlyinc/pointy"
+	"github.com/uitml/quimby/internal/k8s"
+	"github.com/uitml/quimby/internal/resource"
+	"github.com/uitml/quimby/internal/user/reader"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// LintUsername is the user templates are rendered for when linting.
+const LintUsername = "lint123"
+
+// RequiredObjects are the objects quimby reads back from a user namespace, which every template
+// must render, in addition to the namespace itself.
+var RequiredObjects = []string{
+	"ResourceQuota compute-resources",
+	"LimitRange default-resources",
+	"PersistentVolumeClaim storage",
+	"Deployment storage-proxy",
+}
+
+// Cluster facts templates are rendered with when linting
+var lintCluster = resource.Cluster{MaxNodeGPUs: 8, GPUProduct: "NVIDIA-A100-SXM4-40GB"}
+
+// LintCase is a user config a template is rendered with when linting.
+type LintCase struct {
+	Name   string
+	Config Config
+}
+
+// LintCases returns the user configs to lint a template with: the default values, and edge cases
+// derived from them.
+func LintCases(values Config) []LintCase {
+	spec := values.Spec
+	if spec == nil {
+		spec = &resource.Spec{}
+	}
+	md := &Metadata{Fullname: "Lint User", Email: LintUsername + "@" + DefaultEmailDomain, Usertype: "student"}
+
+	// Returns a config with the default values, modified by set
+	with := func(set func(*resource.Spec)) Config {
+		s := spec.DeepCopy()
+		if set != nil {
+			set(s)
+		}
+		return Config{Username: LintUsername, Metadata: md, Spec: s, Cluster: lintCluster}
+	}
+
+	noMetadata := with(nil)
+	noMetadata.Metadata = nil
+
+	return []LintCase{
+		{Name: "default", Config: with(nil)},
+		{Name: "no-metadata", Config: noMetadata},
+		{Name: "no-gpu", Config: with(func(s *resource.Spec) {
+			s.GPU, s.GPUPerJob = pointy.Int64(0), pointy.Int64(0)
+		})},
+		{Name: "cpu-only", Config: with(func(s *resource.Spec) {
+			s.GPU, s.GPUPerJob = pointy.Int64(0), pointy.Int64(0)
+			s.Memory, s.CPU = pointy.Int64(64), pointy.Int64(16)
+		})},
+		{Name: "mig", Config: with(func(s *resource.Spec) {
+			s.Accelerators = map[corev1.ResourceName]int64{"nvidia.com/mig-1g.10gb": 7}
+		})},
+		{Name: "gpu-model", Config: with(func(s *resource.Spec) {
+			s.GPUModels = []string{lintCluster.GPUProduct}
+		})},
+		{Name: "many-gpus", Config: with(func(s *resource.Spec) {
+			s.GPU = pointy.Int64(64)
+		})},
+		{Name: "huge-storage", Config: with(func(s *resource.Spec) {
+			s.StorageSize = pointy.Int64(1 << 20) // 1 PiB
+		})},
+	}
+}
+
+// GoldenPath returns the path of the expected render of a lint case, kept in the testdata directory
+// next to the template in templatePath.
+func GoldenPath(templatePath string, name string) string {
+	return path.Join(path.Dir(templatePath), "testdata", name+".golden.yaml")
+}
+
+// Lint renders the template in templatePath for usr, and checks that every object is valid, belongs to
+// the user namespace and that all RequiredObjects are rendered. Objects of the allowed kinds are
+// accepted besides the supported kinds, as by Apply. Returns the rendered manifest.
+func Lint(templatePath string, rdr reader.Config, usr Config, allowed []schema.GroupVersionKind) ([]byte, error) {
+	manifest, err := GenerateConfig(templatePath, rdr, usr)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := k8s.Decode(manifest)
+	if err != nil {
+		return manifest, err
+	}
+
+	var problems []string
+	rendered := make(map[string]bool)
+	for _, obj := range objs {
+		if err := k8s.ValidateObject(usr.Username, obj, allowed); err != nil {
+			problems = append(problems, err.Error())
+		}
+		rendered[obj.GetKind()+" "+obj.GetName()] = true
+	}
+	for _, required := range append([]string{"Namespace " + usr.Username}, RequiredObjects...) {
+		if !rendered[required] {
+			problems = append(problems, required+": missing")
+		}
+	}
+	if len(problems) > 0 {
+		return manifest, fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+
+	return manifest, nil
+}
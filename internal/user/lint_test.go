@@ -0,0 +1,96 @@
+package user
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/openlyinc/pointy"
+	"github.com/uitml/quimby/internal/resource"
+	"github.com/uitml/quimby/internal/user/reader"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestLintCases(t *testing.T) {
+	values := Config{Spec: &resource.Spec{GPU: pointy.Int64(2), GPUPerJob: pointy.Int64(1), StorageSize: pointy.Int64(100)}}
+
+	cases := LintCases(values)
+	byName := make(map[string]Config)
+	for _, c := range cases {
+		if c.Config.Username != LintUsername {
+			t.Errorf("LintCases() %s has username %q, want %q", c.Name, c.Config.Username, LintUsername)
+		}
+		byName[c.Name] = c.Config
+	}
+
+	if *byName["default"].GPU != 2 {
+		t.Errorf("LintCases() default GPU = %d, want 2", *byName["default"].GPU)
+	}
+	if *byName["no-gpu"].GPU != 0 || *byName["no-gpu"].GPUPerJob != 0 {
+		t.Errorf("LintCases() no-gpu has GPUs")
+	}
+	if byName["no-metadata"].Metadata != nil {
+		t.Errorf("LintCases() no-metadata has metadata")
+	}
+	if *values.GPU != 2 {
+		t.Errorf("LintCases() modified the default values")
+	}
+}
+
+func TestLint(t *testing.T) {
+	values := Config{Spec: &resource.Spec{GPU: pointy.Int64(2), GPUPerJob: pointy.Int64(1), DefaultMemoryPerJob: pointy.Int64(8), StorageSize: pointy.Int64(100)}}
+
+	networkPolicy := schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "NetworkPolicy"}
+
+	tests := []struct {
+		name     string
+		path     string
+		allowed  []schema.GroupVersionKind
+		problems []string
+	}{
+		{
+			name: "Valid template",
+			path: "./testdata/lint_valid.yaml",
+		},
+		{
+			name:    "Allowed kind",
+			path:    "./testdata/lint_allowed.yaml",
+			allowed: []schema.GroupVersionKind{networkPolicy},
+		},
+		{
+			name:     "Kind not allowed",
+			path:     "./testdata/lint_allowed.yaml",
+			problems: []string{`NetworkPolicy deny-all: kind "NetworkPolicy" is not supported`},
+		},
+		{
+			name: "Invalid template",
+			path: "./testdata/lint_invalid.yaml",
+			problems: []string{
+				"ResourceQuota compute-resources: namespace is kube-system",
+				"LimitRange default-resources: quantities must match",
+				"PersistentVolumeClaim storage: missing",
+				"Deployment storage-proxy: missing",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, c := range LintCases(values) {
+				_, err := Lint(tt.path, &reader.File{}, c.Config, tt.allowed)
+				if len(tt.problems) == 0 {
+					if err != nil {
+						t.Errorf("Lint() %s error = %v", c.Name, err)
+					}
+					continue
+				}
+				if err == nil {
+					t.Fatalf("Lint() %s did not fail", c.Name)
+				}
+				for _, p := range tt.problems {
+					if !strings.Contains(err.Error(), p) {
+						t.Errorf("Lint() %s error = %v, want it to contain %q", c.Name, err, p)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package reader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// ErrNotModified is returned by a ConditionalReader when the file still matches the given ETag.
+var ErrNotModified = errors.New("not modified")
+
+// ConditionalReader is implemented by readers that can revalidate a cached file.
+type ConditionalReader interface {
+	// ReadIfChanged reads a file along with its ETag. If etag is not empty and still matches
+	// the file, ErrNotModified is returned instead.
+	ReadIfChanged(path string, etag string) ([]byte, string, error)
+}
+
+// Cached stores the files read through Reader in Dir, and serves the stored copy when Reader
+// can not be reached or fails with a server error. Other errors, e.g. bad credentials or rate
+// limits, are returned so that they are not hidden behind the cache. Files are revalidated on
+// every read if Reader is a ConditionalReader.
+type Cached struct {
+	Reader Config
+	Dir    string
+	Key    string    // identifies the source, e.g. its repo and ref
+	Warn   io.Writer // defaults to os.Stderr
+}
+
+type cacheEntry struct {
+	ETag    string `json:"etag,omitempty"`
+	Content []byte `json:"content"`
+}
+
+// Returns the file the entry of path is stored in.
+func (c *Cached) file(path string) string {
+	sum := sha256.Sum256([]byte(c.Key + "\x00" + path))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:]))
+}
+
+func (c *Cached) load(path string) (*cacheEntry, bool) {
+	b, err := ioutil.ReadFile(c.file(path))
+	if err != nil {
+		return nil, false
+	}
+	entry := cacheEntry{}
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return nil, false
+	}
+
+	return &entry, true
+}
+
+// Stores the entry of path, replacing any previous entry atomically.
+func (c *Cached) store(path string, entry *cacheEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(c.Dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.file(path))
+}
+
+func (c *Cached) warn(format string, a ...interface{}) {
+	w := c.Warn
+	if w == nil {
+		w = os.Stderr
+	}
+	fmt.Fprintf(w, "Warning: "+format+"\n", a...)
+}
+
+// Returns true if err means that the source could not be reached, rather than that it refused
+// the request or that the file is gone from it.
+func unreachable(err error) bool {
+	if errors.Is(err, ErrServer) {
+		return true
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+
+	return errors.As(err, &netErr)
+}
+
+func (c *Cached) Read(path string) ([]byte, error) {
+	entry, cached := c.load(path)
+
+	var content []byte
+	var etag string
+	var err error
+	if cr, ok := c.Reader.(ConditionalReader); ok {
+		var known string
+		if cached {
+			known = entry.ETag
+		}
+		content, etag, err = cr.ReadIfChanged(path, known)
+		if errors.Is(err, ErrNotModified) && cached {
+			return entry.Content, nil
+		}
+	} else {
+		content, err = c.Reader.Read(path)
+	}
+
+	if err != nil {
+		if cached && unreachable(err) {
+			c.warn("%v, using cached copy of %s", err, path)
+			return entry.Content, nil
+		}
+		return nil, err
+	}
+
+	if err := c.store(path, &cacheEntry{ETag: etag, Content: content}); err != nil {
+		c.warn("caching %s: %v", path, err)
+	}
+
+	return content, nil
+}
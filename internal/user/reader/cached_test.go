@@ -0,0 +1,132 @@
+package reader
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"strings"
+	"testing"
+)
+
+// In-memory source, which fails every read while down, or with fail if set.
+type fakeSource struct {
+	files map[string]string
+	down  bool
+	fail  error
+	reads int
+}
+
+func (s *fakeSource) Read(path string) ([]byte, error) {
+	b, _, err := s.ReadIfChanged(path, "")
+	return b, err
+}
+
+func (s *fakeSource) ReadIfChanged(path string, etag string) ([]byte, string, error) {
+	if s.down {
+		return nil, "", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	}
+	if s.fail != nil {
+		return nil, "", s.fail
+	}
+	content, ok := s.files[path]
+	if !ok {
+		return nil, "", fs.ErrNotExist
+	}
+	current := fmt.Sprintf("%q", content)
+	if etag == current {
+		return nil, "", ErrNotModified
+	}
+	s.reads++
+
+	return []byte(content), current, nil
+}
+
+func TestCached_Read(t *testing.T) {
+	src := &fakeSource{files: map[string]string{"values/default-user.yaml": "gpu: 1\n"}}
+	var warnings bytes.Buffer
+	c := &Cached{Reader: src, Dir: t.TempDir(), Key: "uitml/templates@main", Warn: &warnings}
+	read := func(want string) {
+		t.Helper()
+		got, err := c.Read("values/default-user.yaml")
+		if err != nil {
+			t.Fatalf("Cached.Read() error = %v", err)
+		}
+		if string(got) != want {
+			t.Errorf("Cached.Read() = %q, want %q", got, want)
+		}
+	}
+
+	read("gpu: 1\n")
+	read("gpu: 1\n")
+	if src.reads != 1 {
+		t.Errorf("Cached.Read() fetched the unchanged file %d times, want 1", src.reads)
+	}
+
+	src.files["values/default-user.yaml"] = "gpu: 2\n"
+	read("gpu: 2\n")
+
+	src.down = true
+	read("gpu: 2\n")
+	if !strings.Contains(warnings.String(), "using cached copy") {
+		t.Errorf("Cached.Read() warnings = %q, want a warning about the cached copy", warnings.String())
+	}
+
+	// Files that have not been cached can not be read while the source is down
+	if _, err := c.Read("values/other.yaml"); err == nil {
+		t.Errorf("Cached.Read() of uncached file while down did not fail")
+	}
+
+	// Files removed from the source are not served from the cache
+	src.down = false
+	delete(src.files, "values/default-user.yaml")
+	if _, err := c.Read("values/default-user.yaml"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Cached.Read() of removed file error = %v, want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestCached_Read_errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		fallback bool
+	}{
+		{name: "Server error", err: fmt.Errorf("%w: 502 Bad Gateway", ErrServer), fallback: true},
+		{name: "Unauthorized", err: ErrUnauthorized},
+		{name: "Forbidden", err: ErrForbidden},
+		{name: "Rate limited", err: ErrRateLimited},
+		{name: "Other", err: errors.New("github: 422 Unprocessable Entity")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := &fakeSource{files: map[string]string{"a": "cached"}}
+			c := &Cached{Reader: src, Dir: t.TempDir(), Key: "uitml/templates@main", Warn: &bytes.Buffer{}}
+			if _, err := c.Read("a"); err != nil {
+				t.Fatal(err)
+			}
+
+			src.fail = tt.err
+			got, err := c.Read("a")
+			if tt.fallback && (err != nil || string(got) != "cached") {
+				t.Errorf("Cached.Read() = %q, %v, want the cached copy", got, err)
+			}
+			if !tt.fallback && !errors.Is(err, tt.err) {
+				t.Errorf("Cached.Read() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCached_Key(t *testing.T) {
+	dir := t.TempDir()
+	main := &Cached{Reader: &fakeSource{files: map[string]string{"a": "main"}}, Dir: dir, Key: "uitml/templates@main"}
+	v1 := &Cached{Reader: &fakeSource{files: map[string]string{"a": "v1"}, down: true}, Dir: dir, Key: "uitml/templates@v1", Warn: &bytes.Buffer{}}
+
+	if _, err := main.Read("a"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := v1.Read("a"); err == nil {
+		t.Errorf("Cached.Read() = %q, read the copy cached for another key", got)
+	}
+}
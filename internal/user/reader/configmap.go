@@ -0,0 +1,53 @@
+package reader
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// ConfigMapGetter gets ConfigMaps from the cluster.
+type ConfigMapGetter interface {
+	ConfigMap(ctx context.Context, namespace string, name string) (*corev1.ConfigMap, error)
+}
+
+// ConfigMap reads files from the keys of a ConfigMap in the cluster. Paths are mapped to keys
+// with ConfigMapKey.
+type ConfigMap struct {
+	Client    ConfigMapGetter
+	Namespace string
+	Name      string
+	Context   context.Context // cancels the requests, defaults to context.Background()
+}
+
+// ConfigMapKey returns the ConfigMap key a file path is stored under. Keys can not contain '/',
+// so values/default-user.yaml is stored as values.default-user.yaml.
+func ConfigMapKey(p string) string {
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	return strings.ReplaceAll(p, "/", ".")
+}
+
+func (c *ConfigMap) Read(p string) ([]byte, error) {
+	cm, err := c.Client.ConfigMap(orBackground(c.Context), c.Namespace, c.Name)
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("configmap %s/%s: %w", c.Namespace, c.Name, fs.ErrNotExist)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := ConfigMapKey(p)
+	if data, ok := cm.Data[key]; ok {
+		return []byte(data), nil
+	}
+	if data, ok := cm.BinaryData[key]; ok {
+		return data, nil
+	}
+
+	return nil, fmt.Errorf("configmap %s/%s: key %s: %w", c.Namespace, c.Name, key, fs.ErrNotExist)
+}
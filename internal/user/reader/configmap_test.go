@@ -0,0 +1,78 @@
+package reader
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/uitml/quimby/internal/k8s"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigMapKey(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "default-user.yaml", want: "default-user.yaml"},
+		{path: "values/default-user.yaml", want: "values.default-user.yaml"},
+		{path: "/config/default-user-quimby.yaml", want: "config.default-user-quimby.yaml"},
+		{path: "values//usertypes/phd.yaml", want: "values.usertypes.phd.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := ConfigMapKey(tt.path); got != tt.want {
+				t.Errorf("ConfigMapKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigMap_Read(t *testing.T) {
+	client := &k8s.Client{Clientset: fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "quimby-templates", Namespace: "quimby-system"},
+		Data:       map[string]string{"values.default-user.yaml": "gpu: 1\n"},
+	})}
+
+	tests := []struct {
+		name     string
+		cmName   string
+		path     string
+		want     string
+		notExist bool
+	}{
+		{
+			name:   "Existing key",
+			cmName: "quimby-templates",
+			path:   "values/default-user.yaml",
+			want:   "gpu: 1\n",
+		},
+		{
+			name:     "Missing key",
+			cmName:   "quimby-templates",
+			path:     "config/default-user-quimby.yaml",
+			notExist: true,
+		},
+		{
+			name:     "Missing ConfigMap",
+			cmName:   "missing",
+			path:     "values/default-user.yaml",
+			notExist: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &ConfigMap{Client: client, Namespace: "quimby-system", Name: tt.cmName}
+			got, err := c.Read(tt.path)
+			if errors.Is(err, fs.ErrNotExist) != tt.notExist {
+				t.Errorf("ConfigMap.Read() error = %v, notExist %v", err, tt.notExist)
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("ConfigMap.Read() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package reader
+
+import (
+	"io/ioutil"
+	"path/filepath"
+)
+
+// Dir reads files relative to a local directory.
+type Dir struct {
+	Root string
+}
+
+func (d *Dir) Read(path string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(d.Root, filepath.FromSlash(path)))
+}
@@ -0,0 +1,55 @@
+package reader
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDir_Read(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "values"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "values", "default-user.yaml"), []byte("foo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		want     string
+		notExist bool
+	}{
+		{
+			name: "Relative path",
+			path: "values/default-user.yaml",
+			want: "foo",
+		},
+		{
+			name: "Path with empty directory prefix",
+			path: "/values/default-user.yaml",
+			want: "foo",
+		},
+		{
+			name:     "Missing file",
+			path:     "values/missing.yaml",
+			notExist: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Dir{Root: root}
+			got, err := d.Read(tt.path)
+			if errors.Is(err, fs.ErrNotExist) != tt.notExist {
+				t.Errorf("Dir.Read() error = %v, notExist %v", err, tt.notExist)
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("Dir.Read() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package reader
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// FS reads files from a file system, such as the templates embedded in the binary.
+type FS struct {
+	FS fs.FS
+}
+
+func (f *FS) Read(p string) ([]byte, error) {
+	return fs.ReadFile(f.FS, strings.TrimPrefix(path.Clean("/"+p), "/"))
+}
@@ -0,0 +1,59 @@
+package reader
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// Git reads files at a ref (branch, tag or commit) of a local git clone, without touching its
+// working tree.
+type Git struct {
+	Repo string
+	Ref  string // defaults to HEAD
+}
+
+// Runs git in the repo and returns its output.
+func (g *Git) git(args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	command := exec.Command("git", append([]string{"-C", g.Repo}, args...)...)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	if err := command.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", strings.Join(args, " "), msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// Read returns the file at p in the ref. Only a file missing from an existing ref is reported as
+// fs.ErrNotExist, a missing ref, repo or git binary is an error of its own.
+func (g *Git) Read(p string) ([]byte, error) {
+	ref := g.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+
+	commit, err := g.git("rev-parse", "--verify", ref+"^{commit}")
+	if err != nil {
+		return nil, err
+	}
+	object := strings.TrimSpace(string(commit))
+
+	entry, err := g.git("ls-tree", "--name-only", object, "--", p)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(entry)) == 0 {
+		return nil, fmt.Errorf("%s:%s: %w", ref, p, fs.ErrNotExist)
+	}
+
+	return g.git("cat-file", "blob", object+":"+p)
+}
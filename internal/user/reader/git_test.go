@@ -0,0 +1,109 @@
+package reader
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// Creates a git repo with two commits of values/default-user.yaml, tagged v1 and v2.
+func newGitRepo(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repo := t.TempDir()
+	run := func(args ...string) {
+		command := exec.Command("git", append([]string{"-C", repo}, args...)...)
+		command.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=quimby", "GIT_AUTHOR_EMAIL=quimby@example.com",
+			"GIT_COMMITTER_NAME=quimby", "GIT_COMMITTER_EMAIL=quimby@example.com",
+		)
+		if out, err := command.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s", args, out)
+		}
+	}
+	write := func(content string) {
+		if err := os.WriteFile(filepath.Join(repo, "values", "default-user.yaml"), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Join(repo, "values"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	run("init", "-q")
+	write("v1")
+	run("add", ".")
+	run("commit", "-q", "-m", "v1")
+	run("tag", "v1")
+	write("v2")
+	run("commit", "-q", "-am", "v2")
+	run("tag", "v2")
+	// Uncommitted changes must not be read
+	write("dirty")
+
+	return repo
+}
+
+func TestGit_Read(t *testing.T) {
+	repo := newGitRepo(t)
+
+	tests := []struct {
+		name     string
+		repo     string // defaults to the test repo
+		ref      string
+		path     string
+		want     string
+		notExist bool
+		wantErr  bool
+	}{
+		{
+			name: "Default ref",
+			path: "values/default-user.yaml",
+			want: "v2",
+		},
+		{
+			name: "Tag",
+			ref:  "v1",
+			path: "/values/default-user.yaml",
+			want: "v1",
+		},
+		{
+			name:     "Missing file",
+			path:     "values/missing.yaml",
+			notExist: true,
+		},
+		{
+			name:    "Missing ref",
+			ref:     "v3",
+			path:    "values/default-user.yaml",
+			wantErr: true,
+		},
+		{
+			name:    "Not a repo",
+			repo:    t.TempDir(),
+			path:    "values/default-user.yaml",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &Git{Repo: repo, Ref: tt.ref}
+			if tt.repo != "" {
+				g.Repo = tt.repo
+			}
+			got, err := g.Read(tt.path)
+			if errors.Is(err, fs.ErrNotExist) != tt.notExist || (err != nil) != (tt.notExist || tt.wantErr) {
+				t.Errorf("Git.Read() error = %v, notExist %v, wantErr %v", err, tt.notExist, tt.wantErr)
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("Git.Read() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,17 +1,53 @@
 package reader
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// DefaultGithubURL is the API base URL of github.com.
+const DefaultGithubURL = "https://api.github.com"
+
+var (
+	ErrUnauthorized = errors.New("github: bad credentials")
+	ErrForbidden    = errors.New("github: access denied")
+	ErrRateLimited  = errors.New("github: rate limit exceeded")
+	ErrServer       = errors.New("github: server error")
+)
+
+// Github reads files through the contents API of a GitHub or GitHub Enterprise repo.
 type Github struct {
 	Username string
 	Token    string
 	Repo     string
+	BaseURL  string // defaults to DefaultGithubURL, e.g. https://github.example.com/api/v3 for Enterprise
+	Ref      string // branch, tag or commit, defaults to the default branch of the repo
+
+	Client  *http.Client    // defaults to http.DefaultClient
+	Context context.Context // cancels the requests, defaults to context.Background()
+}
+
+// Response of the contents API for a single file.
+type githubContent struct {
+	Type     string `json:"type"`
+	Encoding string `json:"encoding"`
+	Content  string `json:"content"`
+	Path     string `json:"path"`
+}
+
+// Error response of the GitHub API.
+type githubError struct {
+	Message string `json:"message"`
 }
 
 func basicAuth(username string, token string) string {
@@ -19,44 +55,154 @@ func basicAuth(username string, token string) string {
 	return base64.StdEncoding.EncodeToString([]byte(auth))
 }
 
-// Reads default user config from a specified github repo. This can be private, so authentication is needed.
-func (rdr *Github) Read(path string) ([]byte, error) {
-	req, err := http.NewRequest("GET", "https://api.github.com/repos/"+rdr.Repo+"/contents/"+path, nil)
+func (rdr *Github) url(p string, query url.Values) string {
+	base := rdr.BaseURL
+	if base == "" {
+		base = DefaultGithubURL
+	}
+	u := strings.TrimSuffix(base, "/") + "/repos/" + rdr.Repo + p
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	return u
+}
+
+// Sends an authenticated GET request, and returns an error describing any response that is not
+// 200 OK. If etag is set, ErrNotModified is returned while it matches. The caller must close the
+// body of the returned response.
+func (rdr *Github) get(u string, accept string, etag string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(orBackground(rdr.Context), "GET", u, nil)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Add("Authorization", "Basic "+basicAuth(rdr.Username, rdr.Token))
-	req.Header.Add("Accept", "Accept: application/vnd.github.v3+json")
+	if rdr.Token != "" {
+		req.Header.Add("Authorization", "Basic "+basicAuth(rdr.Username, rdr.Token))
+	}
+	req.Header.Add("Accept", accept)
+	if etag != "" {
+		req.Header.Add("If-None-Match", etag)
+	}
 
-	client := http.Client{}
+	client := rdr.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	if err := rdr.checkResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// Returns an error for responses that are not 200 OK.
+func (rdr *Github) checkResponse(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotModified:
+		return ErrNotModified
+	}
+
+	ghErr := githubError{}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if json.Unmarshal(body, &ghErr) != nil || ghErr.Message == "" {
+		ghErr.Message = resp.Status
+	}
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return fmt.Errorf("%w for repo %s, check githubuser and githubtoken", ErrUnauthorized, rdr.Repo)
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+			if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+				return fmt.Errorf("%w, resets at %s", ErrRateLimited, time.Unix(reset, 0).Format(time.Kitchen))
+			}
+			return ErrRateLimited
+		}
+		return fmt.Errorf("%w to repo %s: %s", ErrForbidden, rdr.Repo, ghErr.Message)
+	case http.StatusNotFound:
+		// Private repos are reported as not found without the right credentials
+		return fmt.Errorf("github: %s not found in repo %s, or the token can not access it: %w",
+			strings.TrimPrefix(resp.Request.URL.Path, "/"), rdr.Repo, fs.ErrNotExist)
+	}
+
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("%w: %s: %s", ErrServer, resp.Status, ghErr.Message)
+	}
+
+	return fmt.Errorf("github: %s: %s", resp.Status, ghErr.Message)
+}
+
+// Reads a file from the repo. This can be private, so authentication is needed.
+func (rdr *Github) Read(p string) ([]byte, error) {
+	content, _, err := rdr.ReadIfChanged(p, "")
+	return content, err
+}
 
-	body, err := io.ReadAll(resp.Body)
+// ReadIfChanged reads a file from the repo along with its ETag, unless it still matches etag.
+func (rdr *Github) ReadIfChanged(p string, etag string) ([]byte, string, error) {
+	query := url.Values{}
+	if rdr.Ref != "" {
+		query.Set("ref", rdr.Ref)
+	}
+	u := rdr.url("/contents/"+strings.TrimPrefix(p, "/"), query)
+
+	resp, err := rdr.get(u, "application/vnd.github.v3+json", etag)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	etag = resp.Header.Get("ETag")
+
+	content := githubContent{}
+	if err := json.NewDecoder(resp.Body).Decode(&content); err != nil {
+		return nil, "", fmt.Errorf("github: decoding contents of %s: %w", p, err)
+	}
+	if content.Type != "file" {
+		return nil, "", fmt.Errorf("github: %s is not a file", p)
 	}
 
-	// Hack. We only need the download URL
-	m := make(map[string]interface{})
-	err = json.Unmarshal(body, &m)
+	var b []byte
+	switch content.Encoding {
+	case "base64":
+		b, err = base64.StdEncoding.DecodeString(content.Content)
+	case "none":
+		// Files above 1 MB are not inlined, but can be fetched raw
+		b, err = rdr.readRaw(u)
+	default:
+		err = fmt.Errorf("github: %s has unsupported encoding %q", p, content.Encoding)
+	}
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	resp, err = http.Get(fmt.Sprint(m["download_url"]))
+
+	return b, etag, nil
+}
+
+// Reads the raw content of a file from the contents API.
+func (rdr *Github) readRaw(u string) ([]byte, error) {
+	resp, err := rdr.get(u, "application/vnd.github.v3.raw", "")
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	// Finally, read and return
-	body, err = io.ReadAll(resp.Body)
+	return io.ReadAll(resp.Body)
+}
+
+// Reachable returns an error if the repo can not be accessed with the credentials.
+func (rdr *Github) Reachable() error {
+	resp, err := rdr.get(rdr.url("", nil), "application/vnd.github.v3+json", "")
 	if err != nil {
-		return nil, err
+		return err
 	}
+	resp.Body.Close()
 
-	return body, nil
+	return nil
 }
@@ -0,0 +1,170 @@
+package reader
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Starts a fake GitHub API serving the files of repo uitml/templates at the refs main and v1.
+func newGithubServer(t *testing.T) *httptest.Server {
+	files := map[string]map[string]string{
+		"main": {"values/default-user.yaml": "gpu: 2\n", "values/large.yaml": "gpu: 8\n"},
+		"v1":   {"values/default-user.yaml": "gpu: 1\n"},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/uitml/templates/contents/", func(w http.ResponseWriter, r *http.Request) {
+		if user, token, ok := r.BasicAuth(); !ok || user != "foo" || token != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message": "Bad credentials"}`))
+			return
+		}
+
+		ref := r.URL.Query().Get("ref")
+		if ref == "" {
+			ref = "main"
+		}
+		p := r.URL.Path[len("/repos/uitml/templates/contents/"):]
+		content, ok := files[ref][p]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "Not Found"}`))
+			return
+		}
+
+		etag := fmt.Sprintf("%q", ref+":"+content)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+
+		// Mimic the API for files above 1 MB, which are only returned raw
+		large := p == "values/large.yaml"
+		if r.Header.Get("Accept") == "application/vnd.github.v3.raw" {
+			w.Write([]byte(content))
+			return
+		}
+		resp := githubContent{Type: "file", Path: p, Encoding: "base64", Content: base64.StdEncoding.EncodeToString([]byte(content))}
+		if large {
+			resp.Encoding, resp.Content = "none", ""
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("/repos/uitml/limited/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", "1700000000")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"message": "API rate limit exceeded"}`))
+	})
+	mux.HandleFunc("/repos/uitml/forbidden/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"message": "Resource not accessible by integration"}`))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestGithub_Read(t *testing.T) {
+	server := newGithubServer(t)
+
+	tests := []struct {
+		name    string
+		rdr     Github
+		path    string
+		want    string
+		wantErr error
+	}{
+		{
+			name: "Default branch",
+			rdr:  Github{Username: "foo", Token: "secret", Repo: "uitml/templates"},
+			path: "values/default-user.yaml",
+			want: "gpu: 2\n",
+		},
+		{
+			name: "Pinned ref",
+			rdr:  Github{Username: "foo", Token: "secret", Repo: "uitml/templates", Ref: "v1"},
+			path: "/values/default-user.yaml",
+			want: "gpu: 1\n",
+		},
+		{
+			name: "Large file",
+			rdr:  Github{Username: "foo", Token: "secret", Repo: "uitml/templates"},
+			path: "values/large.yaml",
+			want: "gpu: 8\n",
+		},
+		{
+			name:    "Missing file",
+			rdr:     Github{Username: "foo", Token: "secret", Repo: "uitml/templates"},
+			path:    "values/missing.yaml",
+			wantErr: fs.ErrNotExist,
+		},
+		{
+			name:    "Bad credentials",
+			rdr:     Github{Username: "foo", Token: "wrong", Repo: "uitml/templates"},
+			path:    "values/default-user.yaml",
+			wantErr: ErrUnauthorized,
+		},
+		{
+			name:    "Rate limited",
+			rdr:     Github{Repo: "uitml/limited"},
+			path:    "values/default-user.yaml",
+			wantErr: ErrRateLimited,
+		},
+		{
+			name:    "Forbidden",
+			rdr:     Github{Repo: "uitml/forbidden"},
+			path:    "values/default-user.yaml",
+			wantErr: ErrForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rdr.BaseURL = server.URL
+			got, err := tt.rdr.Read(tt.path)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Github.Read() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Github.Read() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Github.Read() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGithub_ReadIfChanged(t *testing.T) {
+	server := newGithubServer(t)
+	rdr := &Github{Username: "foo", Token: "secret", Repo: "uitml/templates", BaseURL: server.URL}
+
+	got, etag, err := rdr.ReadIfChanged("values/default-user.yaml", "")
+	if err != nil {
+		t.Fatalf("Github.ReadIfChanged() error = %v", err)
+	}
+	if string(got) != "gpu: 2\n" || etag == "" {
+		t.Errorf("Github.ReadIfChanged() = %q, %q, want the file and its ETag", got, etag)
+	}
+
+	if _, _, err := rdr.ReadIfChanged("values/default-user.yaml", etag); !errors.Is(err, ErrNotModified) {
+		t.Errorf("Github.ReadIfChanged() with current ETag error = %v, want %v", err, ErrNotModified)
+	}
+
+	rdr.Ref = "v1"
+	if got, _, err := rdr.ReadIfChanged("values/default-user.yaml", etag); err != nil || string(got) != "gpu: 1\n" {
+		t.Errorf("Github.ReadIfChanged() with stale ETag = %q, %v, want the file", got, err)
+	}
+}
@@ -1,5 +1,15 @@
 package reader
 
+import "context"
+
 type Config interface {
 	Read(string) ([]byte, error)
 }
+
+// Returns ctx, or the background context if it is nil.
+func orBackground(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
@@ -1,24 +1,26 @@
 package user
 
 import (
-	"github.com/uitml/quimby/internal/k8s"
+	"github.com/uitml/quimby/internal/resource"
 	corev1 "k8s.io/api/core/v1"
 )
 
-func memoryPerGPU(usr User) int64 {
-	// I don't want the program to panic just because some resources on the cluster
-	// is set to zero for one user.
+// Returns the memory quota of the user per GPU, or false for users without GPUs.
+func memoryPerGPU(usr User) (int64, bool) {
 	if usr.ResourceQuota.GPU.Max == 0 {
-		return 0
+		return 0, false
 	}
-	return usr.ResourceQuota.Memory.Max / usr.ResourceQuota.GPU.Max
+	return usr.ResourceQuota.Memory.Max / usr.ResourceQuota.GPU.Max, true
 }
 
 func TotalResourcesUsed(userList []User) map[corev1.ResourceName]int64 {
-	r := map[corev1.ResourceName]int64{k8s.ResourceGPU: 0, corev1.ResourceCPU: 0, corev1.ResourceMemory: 0, corev1.ResourceStorage: 0}
+	r := map[corev1.ResourceName]int64{resource.ResourceGPU: 0, corev1.ResourceCPU: 0, corev1.ResourceMemory: 0, corev1.ResourceStorage: 0}
 
 	for _, usr := range userList {
-		r[k8s.ResourceGPU] += usr.ResourceQuota.GPU.Used
+		r[resource.ResourceGPU] += usr.ResourceQuota.GPU.Used
+		for name, s := range usr.ResourceQuota.Accelerators {
+			r[name] += s.Used
+		}
 		r[corev1.ResourceCPU] += usr.ResourceQuota.CPU.Used
 		r[corev1.ResourceMemory] += usr.ResourceQuota.Memory.Used
 		r[corev1.ResourceStorage] += usr.ResourceQuota.Storage
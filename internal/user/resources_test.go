@@ -4,7 +4,6 @@ import (
 	"reflect"
 	"testing"
 
-	"github.com/uitml/quimby/internal/k8s"
 	"github.com/uitml/quimby/internal/resource"
 	corev1 "k8s.io/api/core/v1"
 )
@@ -34,6 +33,7 @@ func Test_memoryPerGPU(t *testing.T) {
 		name string
 		args args
 		want int64
+		ok   bool
 	}{
 		// Normal usecase
 		{
@@ -50,10 +50,11 @@ func Test_memoryPerGPU(t *testing.T) {
 				),
 			},
 			want: 16 * 1024 * 1024 * 1024,
+			ok:   true,
 		},
 		// No GPUs assigned
 		{
-			name: "Normal usecase",
+			name: "CPU-only user",
 			args: args{
 				usr: newFakeResourceUser(
 					0,  // Max CPU
@@ -70,8 +71,9 @@ func Test_memoryPerGPU(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := memoryPerGPU(tt.args.usr); got != tt.want {
-				t.Errorf("memoryPerGPU() = %v, want %v", got, tt.want)
+			got, ok := memoryPerGPU(tt.args.usr)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("memoryPerGPU() = %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
 			}
 		})
 	}
@@ -93,7 +95,7 @@ func TestTotalResourcesUsed(t *testing.T) {
 				userList: []User{},
 			},
 			want: map[corev1.ResourceName]int64{
-				k8s.ResourceGPU:        0,
+				resource.ResourceGPU:   0,
 				corev1.ResourceCPU:     0,
 				corev1.ResourceMemory:  0,
 				corev1.ResourceStorage: 0,
@@ -119,7 +121,7 @@ func TestTotalResourcesUsed(t *testing.T) {
 				},
 			},
 			want: map[corev1.ResourceName]int64{
-				k8s.ResourceGPU:        0,
+				resource.ResourceGPU:   0,
 				corev1.ResourceCPU:     0,
 				corev1.ResourceMemory:  0,
 				corev1.ResourceStorage: 0,
@@ -148,7 +150,7 @@ func TestTotalResourcesUsed(t *testing.T) {
 				},
 			},
 			want: map[corev1.ResourceName]int64{
-				k8s.ResourceGPU:        1,
+				resource.ResourceGPU:   1,
 				corev1.ResourceCPU:     2500,
 				corev1.ResourceMemory:  16,
 				corev1.ResourceStorage: 500,
@@ -180,7 +182,7 @@ func TestTotalResourcesUsed(t *testing.T) {
 				},
 			},
 			want: map[corev1.ResourceName]int64{
-				k8s.ResourceGPU:        3,
+				resource.ResourceGPU:   3,
 				corev1.ResourceCPU:     7000,
 				corev1.ResourceMemory:  48,
 				corev1.ResourceStorage: 1000,
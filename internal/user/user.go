@@ -5,6 +5,7 @@ This package implements tools and data structures for operating on users.
 package user
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -16,6 +17,9 @@ import (
 	corev1 "k8s.io/api/core/v1"
 )
 
+// Domain of generated e-mail addresses for users without one
+const DefaultEmailDomain = "post.uit.no"
+
 type User struct {
 	Username      string
 	fullname      string
@@ -24,24 +28,42 @@ type User struct {
 	ResourceQuota resource.Quota
 }
 
-func FromNamespace(namespace corev1.Namespace) User {
+// Creates a user from its namespace. Users without an e-mail address get one generated from
+// their username and emailDomain, or DefaultEmailDomain if it is empty.
+func FromNamespace(namespace corev1.Namespace, emailDomain string) User {
 	// I am envisioning storing resource allowance needed (e.g. memory per job) as annotations in namespace and
 	// default values for resources in the cluster somehow (annotation on Springfield?).
 	// Then this could be polled and populated in the list for users with default values (empty annotation)
 	usr := User{
 		Username: namespace.Name,
 		fullname: namespace.Annotations[k8s.AnnotationUserFullname],
-		email:    internalvalidate.DefaultIfEmpty(namespace.Annotations[k8s.AnnotationUserEmail], namespace.Name+"@post.uit.no"),
+		email:    internalvalidate.DefaultIfEmpty(namespace.Annotations[k8s.AnnotationUserEmail], namespace.Name+"@"+internalvalidate.DefaultIfEmpty(emailDomain, DefaultEmailDomain)),
 		usertype: namespace.Labels[k8s.LabelUserType],
 	}
 
 	return usr
 }
 
-func PopulateList(c k8s.ResourceClient, listResources bool) ([]User, error) {
+// NamespaceMetadata returns the metadata set on the namespace of a user, or nil if none is set.
+// Unlike FromNamespace, no e-mail address is made up, so that a template rendered with it keeps
+// the namespace as it is.
+func NamespaceMetadata(namespace corev1.Namespace) *Metadata {
+	md := &Metadata{
+		Fullname: namespace.Annotations[k8s.AnnotationUserFullname],
+		Email:    namespace.Annotations[k8s.AnnotationUserEmail],
+		Usertype: namespace.Labels[k8s.LabelUserType],
+	}
+	if *md == (Metadata{}) {
+		return nil
+	}
+
+	return md
+}
+
+func PopulateList(ctx context.Context, c k8s.ResourceClient, listResources bool, emailDomain string) ([]User, error) {
 	var userList []User
 
-	namespaceList, err := c.NamespaceList()
+	namespaceList, err := c.NamespaceList(ctx)
 
 	if err != nil {
 		return nil, err
@@ -49,11 +71,11 @@ func PopulateList(c k8s.ResourceClient, listResources bool) ([]User, error) {
 
 	for _, namespace := range namespaceList.Items {
 		if internalvalidate.Username(namespace.Name) {
-			newUser := FromNamespace(namespace)
+			newUser := FromNamespace(namespace, emailDomain)
 
 			// Will only poll for resources if flag is true (for efficiency)
 			if listResources {
-				newUser.ResourceQuota, err = c.Quota(namespace.Name)
+				newUser.ResourceQuota, err = c.Quota(ctx, namespace.Name)
 				if err != nil {
 					return nil, err
 				}
@@ -70,7 +92,9 @@ func PopulateList(c k8s.ResourceClient, listResources bool) ([]User, error) {
 	return userList, nil
 }
 
-func ListToTable(userList []User, listResources bool) ([][]string, error) {
+// ListToTable returns a row for each user. With listResources, the quotas are shown as well,
+// with a column for each of the accelerators after the GPUs.
+func ListToTable(userList []User, listResources bool, accelerators []corev1.ResourceName) ([][]string, error) {
 	var table [][]string
 
 	for i, usr := range userList {
@@ -83,10 +107,20 @@ func ListToTable(userList []User, listResources bool) ([][]string, error) {
 
 		// Only show resources if the user has asked for it
 		if listResources {
-			m := memoryPerGPU(usr)
+			q := usr.ResourceQuota
+			perGPU := "-"
+			if m, ok := memoryPerGPU(usr); ok {
+				perGPU = humanize.IBytes(uint64(m))
+			}
 
-			table[i] = append(table[i], fmt.Sprint(usr.ResourceQuota.GPU.Used)+"/"+fmt.Sprint(usr.ResourceQuota.GPU.Max))
-			table[i] = append(table[i], humanize.IBytes(uint64(m)))
+			table[i] = append(table[i], fmt.Sprint(q.GPU.Used)+"/"+fmt.Sprint(q.GPU.Max))
+			for _, name := range accelerators {
+				a := q.Accelerators[name]
+				table[i] = append(table[i], fmt.Sprint(a.Used)+"/"+fmt.Sprint(a.Max))
+			}
+			table[i] = append(table[i], resource.UnitMillicores.Format(q.CPU.Used)+"/"+resource.UnitMillicores.Format(q.CPU.Max))
+			table[i] = append(table[i], humanize.IBytes(uint64(q.Memory.Used))+"/"+humanize.IBytes(uint64(q.Memory.Max)))
+			table[i] = append(table[i], perGPU)
 			table[i] = append(table[i], humanize.IBytes(uint64(usr.ResourceQuota.Storage)))
 		}
 	}
@@ -5,6 +5,7 @@ This package implements tools and data structures for operating on users.
 package user
 
 import (
+	"context"
 	"reflect"
 	"testing"
 
@@ -17,7 +18,8 @@ import (
 
 func TestFromNamespace(t *testing.T) {
 	type args struct {
-		namespace corev1.Namespace
+		namespace   corev1.Namespace
+		emailDomain string
 	}
 	tests := []struct {
 		name string
@@ -47,16 +49,63 @@ func TestFromNamespace(t *testing.T) {
 			},
 			want: User{Username: "boo001", fullname: "", email: "boo001@post.uit.no", usertype: ""},
 		},
+		{
+			name: "missing e-mail, custom domain",
+			args: args{
+				namespace: *k8s.NewNamespace(
+					"boo001",
+					map[string]string{},
+					map[string]string{},
+				),
+				emailDomain: "uit.no",
+			},
+			want: User{Username: "boo001", fullname: "", email: "boo001@uit.no", usertype: ""},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := FromNamespace(tt.args.namespace); !reflect.DeepEqual(got, tt.want) {
+			if got := FromNamespace(tt.args.namespace, tt.args.emailDomain); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("FromNamespace() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
+func TestNamespaceMetadata(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace *corev1.Namespace
+		want      *Metadata
+	}{
+		{
+			name: "all fields present",
+			namespace: k8s.NewNamespace(
+				"fba000",
+				map[string]string{k8s.LabelUserType: "admin"},
+				map[string]string{k8s.AnnotationUserFullname: "Foo Bar", k8s.AnnotationUserEmail: "foo@bar.baz"},
+			),
+			want: &Metadata{Fullname: "Foo Bar", Email: "foo@bar.baz", Usertype: "admin"},
+		},
+		{
+			// The e-mail address is not made up, unlike FromNamespace
+			name:      "missing e-mail",
+			namespace: k8s.NewNamespace("boo001", map[string]string{k8s.LabelUserType: "student"}, nil),
+			want:      &Metadata{Usertype: "student"},
+		},
+		{
+			name:      "missing annotations and labels",
+			namespace: k8s.NewNamespace("boo001", nil, nil),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NamespaceMetadata(*tt.namespace); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NamespaceMetadata() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestPopulateList(t *testing.T) {
 	type args struct {
 		c             k8s.ResourceClient
@@ -139,7 +188,7 @@ func TestPopulateList(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := PopulateList(tt.args.c, tt.args.listResources)
+			got, err := PopulateList(context.Background(), tt.args.c, tt.args.listResources, "")
 			if (err != nil) != tt.wantErr {
 				t.Errorf("PopulateList() error = %v, wantErr %v", err, tt.wantErr)
 				return
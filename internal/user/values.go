@@ -0,0 +1,101 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+
+	"github.com/uitml/quimby/internal/resource"
+	"github.com/uitml/quimby/internal/user/reader"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var validUsertype = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ValueLayers returns the values files merged for a user, from the most general to the most
+// specific: the default values in valuesPath, then usertypes/<usertype>.yaml and
+// users/<username>.yaml next to it. Layers for an empty usertype or username are left out.
+func ValueLayers(valuesPath string, usertype string, username string) ([]string, error) {
+	dir := path.Dir(valuesPath)
+	layers := []string{valuesPath}
+	if usertype != "" {
+		if !validUsertype.MatchString(usertype) {
+			return nil, fmt.Errorf("invalid usertype: %s", usertype)
+		}
+		layers = append(layers, path.Join(dir, "usertypes", usertype+".yaml"))
+	}
+	if username != "" {
+		layers = append(layers, path.Join(dir, "users", username+".yaml"))
+	}
+
+	return layers, nil
+}
+
+// PopulateLayers populates usr from the values files in layers, where every layer overrides the
+// fields set by the layers before it. The first layer must exist, while missing later layers are
+// skipped. Returns the layer each field was set by, keyed by the field key.
+func (usr *Config) PopulateLayers(layers []string, rdr reader.Config) (map[string]string, error) {
+	setBy := make(map[string]string)
+	for i, layer := range layers {
+		values := Config{}
+		err := values.Populate(layer, rdr)
+		if i > 0 && errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", layer, err)
+		}
+
+		if values.Spec != nil {
+			if usr.Spec == nil {
+				usr.Spec = &resource.Spec{}
+			}
+			for _, f := range resource.SpecFields {
+				if v := f.Get(values.Spec); v != nil {
+					f.Set(usr.Spec, v)
+					setBy[f.Key] = layer
+				}
+			}
+			for name, v := range values.Spec.Accelerators {
+				if usr.Spec.Accelerators == nil {
+					usr.Spec.Accelerators = make(map[corev1.ResourceName]int64)
+				}
+				usr.Spec.Accelerators[name] = v
+				setBy[resource.AcceleratorKey(name)] = layer
+			}
+			if values.Spec.GPUModels != nil {
+				usr.Spec.GPUModels = values.Spec.GPUModels
+				setBy[resource.GPUModelsKey] = layer
+			}
+		}
+
+		if values.Metadata != nil {
+			if usr.Metadata == nil {
+				usr.Metadata = &Metadata{}
+			}
+			for key, v := range values.Metadata.fields() {
+				if v == "" {
+					continue
+				}
+				switch key {
+				case "fullname":
+					usr.Fullname = v
+				case "email":
+					usr.Email = v
+				case "usertype":
+					usr.Usertype = v
+				}
+				setBy[key] = layer
+			}
+		}
+	}
+	if usr.Spec != nil {
+		if err := usr.Spec.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return setBy, nil
+}
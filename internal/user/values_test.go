@@ -0,0 +1,118 @@
+package user
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/openlyinc/pointy"
+	"github.com/uitml/quimby/internal/resource"
+	"github.com/uitml/quimby/internal/user/reader"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestValueLayers(t *testing.T) {
+	tests := []struct {
+		name     string
+		usertype string
+		username string
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name: "Default values only",
+			want: []string{"values/default-user.yaml"},
+		},
+		{
+			name:     "All layers",
+			usertype: "phd",
+			username: "foo123",
+			want:     []string{"values/default-user.yaml", "values/usertypes/phd.yaml", "values/users/foo123.yaml"},
+		},
+		{
+			name:     "Usertype escaping the values directory",
+			usertype: "../phd",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValueLayers("values/default-user.yaml", tt.usertype, tt.username)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValueLayers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValueLayers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_PopulateLayers(t *testing.T) {
+	rdr := &reader.Dir{Root: "./testdata/layers"}
+
+	tests := []struct {
+		name      string
+		layers    []string
+		wantSpec  *resource.Spec
+		wantMeta  *Metadata
+		wantSetBy map[string]string
+		wantErr   bool
+	}{
+		{
+			name:     "Default values",
+			layers:   []string{"default-user.yaml"},
+			wantSpec: &resource.Spec{GPU: pointy.Int64(1), GPUPerJob: pointy.Int64(1), MaxMemoryPerJob: pointy.Int64(16), StorageSize: pointy.Int64(100)},
+			wantSetBy: map[string]string{
+				"gpu": "default-user.yaml", "gpuperjob": "default-user.yaml", "maxmemoryperjob": "default-user.yaml", "storagesize": "default-user.yaml",
+			},
+		},
+		{
+			name:   "All layers",
+			layers: []string{"default-user.yaml", "usertypes/phd.yaml", "users/foo123.yaml"},
+			wantSpec: &resource.Spec{
+				GPU: pointy.Int64(4), GPUPerJob: pointy.Int64(1), MaxMemoryPerJob: pointy.Int64(16), StorageSize: pointy.Int64(1000),
+				Accelerators: map[corev1.ResourceName]int64{"nvidia.com/mig-1g.10gb": 2},
+			},
+			wantMeta: &Metadata{Usertype: "phd"},
+			wantSetBy: map[string]string{
+				"gpu": "usertypes/phd.yaml", "gpuperjob": "default-user.yaml", "maxmemoryperjob": "default-user.yaml",
+				"storagesize": "users/foo123.yaml", "usertype": "usertypes/phd.yaml",
+				"accelerators.nvidia.com/mig-1g.10gb": "users/foo123.yaml",
+			},
+		},
+		{
+			name:     "Missing layers are skipped",
+			layers:   []string{"default-user.yaml", "usertypes/student.yaml", "users/bar123.yaml"},
+			wantSpec: &resource.Spec{GPU: pointy.Int64(1), GPUPerJob: pointy.Int64(1), MaxMemoryPerJob: pointy.Int64(16), StorageSize: pointy.Int64(100)},
+			wantSetBy: map[string]string{
+				"gpu": "default-user.yaml", "gpuperjob": "default-user.yaml", "maxmemoryperjob": "default-user.yaml", "storagesize": "default-user.yaml",
+			},
+		},
+		{
+			name:    "Missing default values",
+			layers:  []string{"missing.yaml", "usertypes/phd.yaml"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usr := &Config{Username: "foo123"}
+			setBy, err := usr.PopulateLayers(tt.layers, rdr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Config.PopulateLayers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(usr.Spec, tt.wantSpec) {
+				t.Errorf("Config.PopulateLayers() spec = %v, want %v", resource.DiffSpec(tt.wantSpec, usr.Spec), tt.wantSpec)
+			}
+			if !reflect.DeepEqual(usr.Metadata, tt.wantMeta) {
+				t.Errorf("Config.PopulateLayers() metadata = %v, want %v", usr.Metadata, tt.wantMeta)
+			}
+			if !reflect.DeepEqual(setBy, tt.wantSetBy) {
+				t.Errorf("Config.PopulateLayers() setBy = %v, want %v", setBy, tt.wantSetBy)
+			}
+		})
+	}
+}
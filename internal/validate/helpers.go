@@ -15,3 +15,9 @@ func Username(username string) bool {
 
 	return validUsername.MatchString(username)
 }
+
+func Email(email string) bool {
+	var validEmail = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+	return validEmail.MatchString(email)
+}
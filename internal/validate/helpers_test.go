@@ -102,3 +102,46 @@ func TestUsername(t *testing.T) {
 		})
 	}
 }
+
+func TestEmail(t *testing.T) {
+	type args struct {
+		email string
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		// Testcase 1: valid e-mail. Return true
+		{
+			name: "valid email",
+			args: args{"foo123@post.uit.no"},
+			want: true,
+		},
+		// Testcase 2: missing domain. Return false
+		{
+			name: "missing domain",
+			args: args{"foo123@"},
+			want: false,
+		},
+		// Testcase 3: missing top level domain. Return false
+		{
+			name: "missing tld",
+			args: args{"foo123@uit"},
+			want: false,
+		},
+		// Testcase 4: whitespace in address. Return false
+		{
+			name: "whitespace",
+			args: args{"foo 123@uit.no"},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Email(tt.args.email); got != tt.want {
+				t.Errorf("Email() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}